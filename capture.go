@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CaptureConfig stores stdout of the command as output of the rule, it's
+// available in templates of the next commands as {{.Outputs.name}} and in
+// release description. Value is raw output unless Trim, JSONPath or RegExp
+// is specified.
+type CaptureConfig struct {
+	Name string `yaml:"name" hcl:"name" json:"name"`
+	Trim bool   `yaml:"trim" hcl:"trim" json:"trim"`
+	// JSONPath is a dot-separated path of the value in JSON output, e.g.
+	// status.sync.revision or items.0.name
+	JSONPath    string `yaml:"jsonPath" hcl:"json_path" json:"jsonPath"`
+	RegExp      string `yaml:"regexp" hcl:"regexp" json:"regexp"`
+	RegExpGroup int    `yaml:"regexpGroup" hcl:"regexp_group" json:"regexpGroup"`
+}
+
+func (c *CaptureConfig) Validate() error {
+	if len(c.Name) == 0 {
+		return errors.New("name of capture must be specified")
+	}
+	if len(c.JSONPath) > 0 && len(c.RegExp) > 0 {
+		return fmt.Errorf("capture %s: jsonPath and regexp can't be used together", c.Name)
+	}
+	if len(c.RegExp) > 0 {
+		re, err := regexp.Compile(c.RegExp)
+		if err != nil {
+			return fmt.Errorf("capture %s: failed to parse '%s': %v", c.Name, c.RegExp, err)
+		}
+		if c.RegExpGroup < 0 || c.RegExpGroup > re.NumSubexp() {
+			return fmt.Errorf("capture %s: regexp '%s' has no group %d", c.Name, c.RegExp, c.RegExpGroup)
+		}
+	}
+	return nil
+}
+
+// Value returns captured value of the output
+func (c *CaptureConfig) Value(stdout string) (string, error) {
+	switch {
+	case len(c.JSONPath) > 0:
+		return jsonPathValue(stdout, c.JSONPath)
+	case len(c.RegExp) > 0:
+		// Expression is checked by Validate
+		match := regexp.MustCompile(c.RegExp).FindStringSubmatch(stdout)
+		if match == nil {
+			return "", fmt.Errorf("output doesn't match '%s'", c.RegExp)
+		}
+		return match[c.RegExpGroup], nil
+	case c.Trim:
+		return strings.TrimSpace(stdout), nil
+	}
+	return stdout, nil
+}
+
+// jsonPathValue returns value of JSON document by dot-separated path,
+// strings are returned as is, other values are encoded as JSON
+func jsonPathValue(document, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return "", fmt.Errorf("failed to parse output as JSON: %v", err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			item, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("key '%s' of '%s' not found", key, path)
+			}
+			value = item
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("index '%s' of '%s' not found", key, path)
+			}
+			value = v[i]
+		default:
+			return "", fmt.Errorf("key '%s' of '%s' not found", key, path)
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// outputsNote returns captured outputs for release description
+func outputsNote(outputs map[string]string) string {
+	if len(outputs) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, outputs[name]))
+	}
+	return strings.Join(lines, "\n") + "\n\n"
+}
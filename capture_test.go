@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaptureConfig_Validate(t *testing.T) {
+	tests := []struct {
+		capture *CaptureConfig
+		valid   bool
+	}{
+		{&CaptureConfig{Name: "foo"}, true},
+		{&CaptureConfig{}, false},
+		{&CaptureConfig{Name: "foo", RegExp: "v(\\d+)", RegExpGroup: 1}, true},
+		{&CaptureConfig{Name: "foo", RegExp: "v(\\d+)", RegExpGroup: 2}, false},
+		{&CaptureConfig{Name: "foo", RegExp: "("}, false},
+		{&CaptureConfig{Name: "foo", RegExp: "v", JSONPath: "foo"}, false},
+	}
+	for _, test := range tests {
+		err := test.capture.Validate()
+		if test.valid && err != nil {
+			t.Errorf("%#v: %v", test.capture, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%#v: Must be an error, but got nil", test.capture)
+		}
+	}
+}
+
+func TestCaptureConfig_Value(t *testing.T) {
+	stdout := `{"status": {"revision": "abc", "images": ["foo", "bar"], "replicas": 2}}` + "\n"
+	tests := []struct {
+		capture *CaptureConfig
+		value   string
+	}{
+		{&CaptureConfig{}, stdout},
+		{&CaptureConfig{Trim: true}, strings.TrimSpace(stdout)},
+		{&CaptureConfig{JSONPath: "status.revision"}, "abc"},
+		{&CaptureConfig{JSONPath: "status.images.1"}, "bar"},
+		{&CaptureConfig{JSONPath: "status.replicas"}, "2"},
+		{&CaptureConfig{JSONPath: "status.images"}, `["foo","bar"]`},
+		{&CaptureConfig{RegExp: `"revision": "(\w+)"`, RegExpGroup: 1}, "abc"},
+	}
+	for _, test := range tests {
+		value, err := test.capture.Value(stdout)
+		if err != nil {
+			t.Errorf("%#v: %v", test.capture, err)
+			continue
+		}
+		if value != test.value {
+			t.Errorf("Must be %s, but got %s", test.value, value)
+		}
+	}
+	fails := []*CaptureConfig{
+		{JSONPath: "status.foobar"},
+		{JSONPath: "status.images.2"},
+		{JSONPath: "status.revision.foobar"},
+		{RegExp: "foobar"},
+	}
+	for _, capture := range fails {
+		if _, err := capture.Value(stdout); err == nil {
+			t.Errorf("%#v: Must be an error, but got nil", capture)
+		}
+	}
+	if _, err := (&CaptureConfig{JSONPath: "foo"}).Value("foobar"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestExecCommandMap_Capture(t *testing.T) {
+	tracker := &Tracker{}
+	commands := map[string]*Command{
+		"revision": {
+			Command: []string{"sh", "-c", "echo ' abc '; echo warning >&2"},
+			Capture: &CaptureConfig{Name: "revision", Trim: true},
+		},
+		"sync": {
+			Command: []string{"sh", "-c", "echo {{.Outputs.revision}}"},
+			Capture: &CaptureConfig{Name: "synced"},
+			Needs:   []string{"revision"},
+		},
+	}
+	rule := &Rule{Name: "foo"}
+	if err := tracker.ExecCommandMap(PreProcessCommandType, commands, rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Outputs["revision"] != "abc" {
+		t.Errorf("Must be abc, but got %q", rule.Outputs["revision"])
+	}
+	if rule.Outputs["synced"] != "abc\n" {
+		t.Errorf("Must be abc, but got %q", rule.Outputs["synced"])
+	}
+}
+
+func TestOutputsNote(t *testing.T) {
+	if note := outputsNote(nil); note != "" {
+		t.Errorf("Must be empty, but got %q", note)
+	}
+	note := outputsNote(map[string]string{"version": "1.2", "revision": "abc"})
+	if note != "revision: abc\nversion: 1.2\n\n" {
+		t.Errorf("Must be sorted outputs, but got %q", note)
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ExitCodeOK means that command completed successfully
+	ExitCodeOK = 0
+	// ExitCodeFailed means that command failed while processing rules
+	ExitCodeFailed = 1
+	// ExitCodeUsage means that command line arguments are invalid
+	ExitCodeUsage = 2
+	// ExitCodeConfig means that configuration or environment is invalid
+	ExitCodeConfig = 3
+	// ExitCodeForbidden means that token has no access to the API
+	ExitCodeForbidden = 4
+	// ExitCodeProjectNotFound means that project doesn't exist in the forge
+	ExitCodeProjectNotFound = 5
+	// ExitCodeRateLimited means that API rate limit was exceeded
+	ExitCodeRateLimited = 6
+	// ExitCodeCanceled means that processing was stopped by SIGINT or
+	// SIGTERM
+	ExitCodeCanceled = 130
+
+	defaultCommandName = "run"
+)
+
+// legacyFlags are boolean flags of versions without commands, they are
+// replaced with commands of the same name
+var legacyFlags = []string{"validate", "version"}
+
+type cliCommand struct {
+	Name        string
+	Usage       string
+	Description string
+	// Args is true if command accepts positional arguments
+	Args bool
+	// Setup registers command flags and returns function to run it
+	Setup func(fs *flag.FlagSet) func(args []string) int
+}
+
+// cliOptions are flags shared by all commands
+type cliOptions struct {
+	logLevel   string
+	configFile string
+	env        Environment
+}
+
+var (
+	cliOutput io.Writer = os.Stdout
+
+	cliCommands = []*cliCommand{
+		{
+			Name:        "run",
+			Usage:       "run [flags]",
+			Description: "Process rules: create and move tags, run hooks and checks.",
+			Setup:       runCommand,
+		},
+		{
+			Name:        "plan",
+			Usage:       "plan [flags]",
+			Description: "Print actions to be done by run without changing anything.",
+			Setup:       planCommand,
+		},
+		{
+			Name:        "status",
+			Usage:       "status [flags]",
+			Description: "Print every tracked tag and whether it's behind current commit.",
+			Setup:       statusCommand,
+		},
+		{
+			Name:        "validate",
+			Usage:       "validate [flags]",
+			Description: "Validate configuration file and print it with expanded rules.",
+			Setup:       validateCommand,
+		},
+		{
+			Name:        "rollback",
+			Usage:       "rollback <rule|tag> [flags]",
+			Description: "Move tag back to its previous commit and run post update hooks.",
+			Args:        true,
+			Setup:       rollbackCommand,
+		},
+		{
+			Name:        "prune",
+			Usage:       "prune [flags]",
+			Description: "Delete tags created by the tracker which don't belong to any rule.",
+			Setup:       pruneCommand,
+		},
+		{
+			Name:        "version",
+			Usage:       "version",
+			Description: "Print version.",
+			Setup:       versionCommand,
+		},
+	}
+)
+
+// RunCLI executes command specified by args and returns exit code
+func RunCLI(args []string) int {
+	name := defaultCommandName
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	} else if legacyName, legacyArgs, ok := legacyCommand(args); ok {
+		fmt.Fprintf(os.Stderr, "Flag -%s is deprecated, use '%s' command instead.\n", legacyName, legacyName)
+		name, args = legacyName, legacyArgs
+	}
+	if name == "help" {
+		return helpCommand(args)
+	}
+	cmd := findCLICommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", name)
+		printUsage(os.Stderr)
+		return ExitCodeUsage
+	}
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gitlab-tracker %s\n\n%s\n\nFlags:\n", cmd.Usage, cmd.Description)
+		fs.PrintDefaults()
+	}
+	run := cmd.Setup(fs)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitCodeOK
+		}
+		return ExitCodeUsage
+	}
+	if !cmd.Args && fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "Unexpected arguments: %s\n\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return ExitCodeUsage
+	}
+	return run(fs.Args())
+}
+
+// legacyCommand returns command of the legacy flag found in args and args
+// without the flag, flags which aren't supported by the command are
+// dropped as they were ignored by legacy flags
+func legacyCommand(args []string) (string, []string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		flagName := strings.TrimLeft(arg, "-")
+		if idx := strings.Index(flagName, "="); idx >= 0 {
+			if flagName[idx+1:] != "true" {
+				continue
+			}
+			flagName = flagName[:idx]
+		}
+		for _, legacy := range legacyFlags {
+			if flagName != legacy {
+				continue
+			}
+			if legacy == "version" {
+				return legacy, nil, true
+			}
+			var rest []string
+			for _, a := range append(args[:i:i], args[i+1:]...) {
+				if n := strings.TrimLeft(a, "-"); n == "force" || strings.HasPrefix(n, "force=") {
+					continue
+				}
+				rest = append(rest, a)
+			}
+			return legacy, rest, true
+		}
+	}
+	return "", nil, false
+}
+
+func findCLICommand(name string) *cliCommand {
+	for _, cmd := range cliCommands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		printUsage(cliOutput)
+		return ExitCodeOK
+	}
+	return RunCLI([]string{args[0], "-h"})
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: gitlab-tracker <command> [flags]\n\nCommands:\n")
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(w, "\nRun 'gitlab-tracker help <command>' for details. Command defaults to %q.\n", defaultCommandName)
+}
+
+func (o *cliOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.logLevel, "log-level", GetStringEnv("GT_LOG_LEVEL", "INFO"), "Level of logging.")
+	fs.StringVar(&o.configFile, "config", GetStringEnv("GT_CONFIG", ""), "Path to configuration file, discovered in working directory by default.")
+}
+
+// registerEnvironment registers flags of commands which use CI environment,
+// they override values detected from CI system
+func (o *cliOptions) registerEnvironment(fs *flag.FlagSet) {
+	fs.StringVar(&o.env.Ref, "ref", "", "Current commit, HEAD of working directory outside of CI by default.")
+	fs.StringVar(&o.env.BeforeRef, "before", "", "Previous commit of the branch.")
+	fs.StringVar(&o.env.Project, "project", "", "Path of the project, e.g. group/project.")
+	fs.StringVar(&o.env.APIURL, "api-url", "", "Base URL of the provider API.")
+}
+
+// tracker configures logging and returns Tracker, with GitLab access
+// only if full is true
+func (o *cliOptions) tracker(full bool) (*Tracker, int) {
+	if err := ConfigureLogging(o.logLevel); err != nil {
+		logrus.Error(err)
+		return nil, ExitCodeUsage
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		logrus.Error(err)
+		return nil, ExitCodeFailed
+	}
+	var tracker *Tracker
+	if full {
+		tracker, err = NewTracker(workDir, o.configFile, o.env)
+	} else {
+		tracker, err = LoadTracker(workDir, o.configFile)
+	}
+	if err != nil {
+		logrus.Error(err)
+		return nil, ExitCodeConfig
+	}
+	return tracker, ExitCodeOK
+}
+
+func runCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	opts.registerEnvironment(fs)
+	force := fs.Bool("force", GetBoolEnv("GT_FORCE", false), "Force recreate tags.")
+	return func([]string) int {
+		tracker, code := opts.tracker(true)
+		if tracker == nil {
+			return code
+		}
+		defer handleSignals(tracker)()
+		if err := tracker.Run(*force); err != nil {
+			logrus.Error(err)
+			return exitCodeForError(err)
+		}
+		return ExitCodeOK
+	}
+}
+
+func planCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	opts.registerEnvironment(fs)
+	force := fs.Bool("force", GetBoolEnv("GT_FORCE", false), "Force recreate tags.")
+	output := fs.String("output", "text", "Format of output (text or json).")
+	return func([]string) int {
+		if *output != "text" && *output != "json" {
+			fmt.Fprintf(os.Stderr, "Unsupported output format %q.\n", *output)
+			return ExitCodeUsage
+		}
+		tracker, code := opts.tracker(true)
+		if tracker == nil {
+			return code
+		}
+		plan, err := tracker.BuildPlan(*force)
+		if err != nil {
+			logrus.Error(err)
+		}
+		if *output == "json" {
+			out, err := plan.JSON()
+			if err != nil {
+				logrus.Error(err)
+				return ExitCodeFailed
+			}
+			fmt.Fprintln(cliOutput, string(out))
+		} else {
+			fmt.Fprintln(cliOutput, plan)
+		}
+		if err != nil {
+			return exitCodeForError(err)
+		}
+		return ExitCodeOK
+	}
+}
+
+func validateCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	return func([]string) int {
+		tracker, code := opts.tracker(false)
+		if tracker == nil {
+			return code
+		}
+		out, err := yaml.Marshal(tracker.config)
+		if err != nil {
+			logrus.Error(err)
+			return ExitCodeFailed
+		}
+		fmt.Fprintln(cliOutput, string(out))
+		if err := PrintMatrixSources(cliOutput, tracker.matrixSources); err != nil {
+			logrus.Error(err)
+			return ExitCodeFailed
+		}
+		return ExitCodeOK
+	}
+}
+
+func statusCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	opts.registerEnvironment(fs)
+	output := fs.String("output", "text", "Format of output (text or json).")
+	return func([]string) int {
+		if *output != "text" && *output != "json" {
+			fmt.Fprintf(os.Stderr, "Unsupported output format %q.\n", *output)
+			return ExitCodeUsage
+		}
+		tracker, code := opts.tracker(true)
+		if tracker == nil {
+			return code
+		}
+		statuses := tracker.Status()
+		if *output == "json" {
+			out, err := json.MarshalIndent(statuses, "", "  ")
+			if err != nil {
+				logrus.Error(err)
+				return ExitCodeFailed
+			}
+			fmt.Fprintln(cliOutput, string(out))
+		} else if err := PrintStatus(cliOutput, statuses); err != nil {
+			logrus.Error(err)
+			return ExitCodeFailed
+		}
+		for _, status := range statuses {
+			if len(status.Error) > 0 {
+				return ExitCodeFailed
+			}
+		}
+		return ExitCodeOK
+	}
+}
+
+func rollbackCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	opts.registerEnvironment(fs)
+	to := fs.String("to", "", "Commit to move tag to.")
+	steps := fs.Int("steps", 1, "Number of previous tag positions to go back.")
+	return func(args []string) int {
+		if len(args) == 0 {
+			fmt.Fprintf(fs.Output(), "Rule or tag name must be specified.\n\n")
+			fs.Usage()
+			return ExitCodeUsage
+		}
+		name := args[0]
+		// Flags can be specified after the name
+		if err := fs.Parse(args[1:]); err != nil {
+			return ExitCodeUsage
+		}
+		if fs.NArg() > 0 {
+			fmt.Fprintf(fs.Output(), "Unexpected arguments: %s\n\n", strings.Join(fs.Args(), " "))
+			fs.Usage()
+			return ExitCodeUsage
+		}
+		if len(*to) > 0 && *steps != 1 {
+			fmt.Fprintf(fs.Output(), "Flags -to and -steps can't be used together.\n")
+			return ExitCodeUsage
+		}
+		tracker, code := opts.tracker(true)
+		if tracker == nil {
+			return code
+		}
+		defer handleSignals(tracker)()
+		if err := tracker.Rollback(name, *to, *steps); err != nil {
+			logrus.Error(err)
+			return exitCodeForError(err)
+		}
+		return ExitCodeOK
+	}
+}
+
+func pruneCommand(fs *flag.FlagSet) func([]string) int {
+	opts := &cliOptions{}
+	opts.register(fs)
+	opts.registerEnvironment(fs)
+	dryRun := fs.Bool("dry-run", false, "Print orphan tags and hooks without deleting them.")
+	return func([]string) int {
+		tracker, code := opts.tracker(true)
+		if tracker == nil {
+			return code
+		}
+		if *dryRun {
+			plan, err := tracker.BuildPrunePlan()
+			if err != nil {
+				logrus.Error(err)
+			}
+			fmt.Fprintln(cliOutput, plan)
+			if err != nil {
+				return exitCodeForError(err)
+			}
+			return ExitCodeOK
+		}
+		defer handleSignals(tracker)()
+		if err := tracker.Prune(); err != nil {
+			logrus.Error(err)
+			return exitCodeForError(err)
+		}
+		return ExitCodeOK
+	}
+}
+
+// exitCodeForError returns exit code for known forge errors, including
+// errors of the failed rules, or ExitCodeFailed
+func exitCodeForError(err error) int {
+	if IsErrCanceled(err) {
+		return ExitCodeCanceled
+	}
+	errs := []error{err}
+	if e, ok := err.(ErrRulesFailed); ok {
+		errs = errs[:0]
+		for _, ruleErr := range e.Errors {
+			errs = append(errs, ruleErr)
+		}
+	}
+	codes := []struct {
+		kind ForgeErrorKind
+		code int
+	}{
+		{ProjectNotFoundForgeError, ExitCodeProjectNotFound},
+		{ForbiddenForgeError, ExitCodeForbidden},
+		{RateLimitedForgeError, ExitCodeRateLimited},
+	}
+	for _, c := range codes {
+		for _, e := range errs {
+			if rolledBack, ok := e.(ErrTagMoveRolledBack); ok {
+				e = rolledBack.Err
+			}
+			if IsErrForge(e, c.kind) {
+				return c.code
+			}
+		}
+	}
+	return ExitCodeFailed
+}
+
+func versionCommand(fs *flag.FlagSet) func([]string) int {
+	return func([]string) int {
+		fmt.Fprintln(cliOutput, GetVersion())
+		return ExitCodeOK
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunCLI(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	stdout := cliOutput
+	cliOutput = buf
+	defer func() {
+		cliOutput = stdout
+	}()
+	cleanupEnvVars()
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{
+			args:   []string{"version"},
+			code:   ExitCodeOK,
+			output: GetVersion(),
+		},
+		{
+			args:   []string{"help"},
+			code:   ExitCodeOK,
+			output: "Commands:",
+		},
+		{
+			args:   []string{"validate", "-config", "test_data/valid.yaml"},
+			code:   ExitCodeOK,
+			output: "prepare-environment.sh",
+		},
+		{
+			args: []string{"validate", "-config", "test_data/invalid.yaml"},
+			code: ExitCodeConfig,
+		},
+		{
+			args: []string{"validate", "foobar"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"validate", "-log-level", "foobar"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"foobar"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"run", "-foobar"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"-force"},
+			code: ExitCodeConfig,
+		},
+		{
+			args: []string{"plan", "-output", "yaml"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"rollback"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"rollback", "foobar", "-to", "000", "-steps", "2"},
+			code: ExitCodeUsage,
+		},
+		{
+			args: []string{"rollback", "foobar", "-steps", "2"},
+			code: ExitCodeConfig,
+		},
+		{
+			args: []string{"plan"},
+			code: ExitCodeConfig,
+		},
+		{
+			args:   []string{"-version"},
+			code:   ExitCodeOK,
+			output: GetVersion(),
+		},
+		{
+			args:   []string{"-log-level", "debug", "--version"},
+			code:   ExitCodeOK,
+			output: GetVersion(),
+		},
+		{
+			args:   []string{"-force", "-validate", "-config", "test_data/valid.yaml"},
+			code:   ExitCodeOK,
+			output: "prepare-environment.sh",
+		},
+		{
+			args: []string{"-validate=true", "-config", "test_data/invalid.yaml"},
+			code: ExitCodeConfig,
+		},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		code := RunCLI(test.args)
+		if code != test.code {
+			t.Errorf("%v. Must be %d, but got %d", test.args, test.code, code)
+		}
+		if !strings.Contains(buf.String(), test.output) {
+			t.Errorf("%v. Output must contain %q, but got %q", test.args, test.output, buf.String())
+		}
+	}
+}
+
+func TestExitCodeForError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{
+			err:  errors.New("failed"),
+			code: ExitCodeFailed,
+		},
+		{
+			err:  ErrForge{Kind: ForbiddenForgeError},
+			code: ExitCodeForbidden,
+		},
+		{
+			err: ErrRulesFailed{
+				Errors: map[string]error{
+					"a": errors.New("failed"),
+					"b": ErrForge{Kind: RateLimitedForgeError},
+					"c": ErrForge{Kind: ProjectNotFoundForgeError},
+				},
+			},
+			code: ExitCodeProjectNotFound,
+		},
+		{
+			err: ErrRulesFailed{
+				Errors: map[string]error{
+					"a": ErrTagMoveRolledBack{Err: ErrForge{Kind: RateLimitedForgeError}},
+				},
+			},
+			code: ExitCodeRateLimited,
+		},
+		{
+			err: ErrRulesFailed{
+				Errors: map[string]error{
+					"a": ErrForge{Kind: TagNotFoundForgeError},
+				},
+			},
+			code: ExitCodeFailed,
+		},
+		{
+			err:  ErrCanceled{Err: ErrForge{Kind: ForbiddenForgeError}},
+			code: ExitCodeCanceled,
+		},
+	}
+	for _, test := range tests {
+		if code := exitCodeForError(test.err); code != test.code {
+			t.Errorf("%v. Must be %d, but got %d", test.err, test.code, code)
+		}
+	}
+}
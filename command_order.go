@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandOrder returns names of commands in order of execution: every
+// command goes after commands it needs, independent commands are sorted by
+// Order and then by name. Unknown needs and cycles are reported as errors.
+func commandOrder(commands map[string]*Command) ([]string, error) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := commandOrderOf(commands[names[i]]), commandOrderOf(commands[names[j]])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		order []string
+		state = make(map[string]int)
+		visit func(name string, stack []string) error
+	)
+	visit = func(name string, stack []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("command cycle: %s -> %s", strings.Join(stack, " -> "), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		if command := commands[name]; command != nil {
+			for _, need := range command.Needs {
+				if _, ok := commands[need]; !ok {
+					return fmt.Errorf("command '%s' needs unknown command '%s'", name, need)
+				}
+				if err := visit(need, append(stack, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func commandOrderOf(command *Command) int {
+	if command == nil {
+		return 0
+	}
+	return command.Order
+}
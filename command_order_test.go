@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandOrder(t *testing.T) {
+	tests := []struct {
+		commands map[string]*Command
+		order    []string
+		fail     bool
+	}{
+		{
+			commands: map[string]*Command{
+				"c": {},
+				"b": {},
+				"a": {},
+			},
+			order: []string{"a", "b", "c"},
+		},
+		{
+			commands: map[string]*Command{
+				"a": {Order: 2},
+				"b": {Order: 1},
+				"c": nil,
+			},
+			order: []string{"c", "b", "a"},
+		},
+		{
+			commands: map[string]*Command{
+				"argocd_set": {},
+				"argocd_sync": {
+					Needs: []string{"argocd_wait", "argocd_set"},
+				},
+				"argocd_wait": {
+					Order: 10,
+				},
+			},
+			order: []string{"argocd_set", "argocd_wait", "argocd_sync"},
+		},
+		{
+			commands: map[string]*Command{
+				"a": {Needs: []string{"b"}},
+				"b": {Needs: []string{"c"}},
+				"c": {Needs: []string{"a"}},
+			},
+			fail: true,
+		},
+		{
+			commands: map[string]*Command{
+				"a": {Needs: []string{"foobar"}},
+			},
+			fail: true,
+		},
+	}
+	for i, test := range tests {
+		order, err := commandOrder(test.commands)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%d. Must be an error, but got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%d. Must be %v, but got %v", i, test.order, order)
+		}
+	}
+}
+
+func TestExecCommandMap_Order(t *testing.T) {
+	tracker := &Tracker{
+		plan: &Plan{},
+	}
+	commands := map[string]*Command{
+		"sync": {
+			Command: []string{"argocd", "app", "sync", "{{.Tag}}"},
+			Needs:   []string{"set"},
+		},
+		"set": {
+			Command: []string{"argocd", "app", "set", "{{.Tag}}"},
+		},
+		"notify": {
+			Command: []string{"notify", "{{.Tag}}"},
+			Order:   1,
+		},
+	}
+	for i := 0; i < 10; i++ {
+		tracker.plan = &Plan{}
+		if err := tracker.ExecCommandMap(PostUpdateTagCommandType, commands, &Rule{Tag: "app"}); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, action := range tracker.plan.Actions {
+			names = append(names, action.Name)
+		}
+		expected := []string{"set", "sync", "notify"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("Must be %v, but got %v", expected, names)
+		}
+	}
+	commands["set"].Needs = []string{"sync"}
+	if err := tracker.ExecCommandMap(PostUpdateTagCommandType, commands, &Rule{Tag: "app"}); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
@@ -5,10 +5,27 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 const (
 	configFilenameBase = ".gitlab-tracker"
+
+	// StaleRefSkip skips moving tag to a commit that isn't a descendant of
+	// the tag commit, it's a default behaviour
+	StaleRefSkip = "skip"
+	// StaleRefFail fails the rule in the same case
+	StaleRefFail = "fail"
+
+	// DiffSourceGit finds changes with local git, it's a default source
+	DiffSourceGit = "git"
+	// DiffSourceAPI finds changes with compare API of the provider
+	DiffSourceAPI = "api"
+
+	defaultFetchDepthLimit = 500
+	fetchDepthStep         = 50
 )
 
 var (
@@ -24,8 +41,27 @@ type Config struct {
 	Checks        ChecksConfig     `yaml:"checks" hcl:"checks" json:"checks"`
 	Hooks         HooksConfig      `yaml:"hooks" hcl:"hooks" json:"hooks"`
 	Rules         map[string]*Rule `yaml:"rules" hcl:"rules" json:"rules"`
-	Matrix        []string         `yaml:"matrix" hcl:"matrix" json:"matrix"`
+	Matrix        []interface{}    `yaml:"matrix" hcl:"matrix" json:"matrix"`
 	MatrixFromDir string           `yaml:"matrixFromDir" hcl:"matrix_from_dir" json:"matrixFromDir"`
+	Concurrency   int              `yaml:"concurrency" hcl:"concurrency" json:"concurrency"`
+	OnStaleRef    string           `yaml:"onStaleRef" hcl:"on_stale_ref" json:"onStaleRef"`
+	Provider      string           `yaml:"provider" hcl:"provider" json:"provider"`
+	GitRemote     string           `yaml:"gitRemote" hcl:"git_remote" json:"gitRemote"`
+	// FetchDepthLimit is a maximum number of commits shallow clone is
+	// deepened by to find missing commits, negative value disables fetching
+	FetchDepthLimit int `yaml:"fetchDepthLimit" hcl:"fetch_depth_limit" json:"fetchDepthLimit"`
+	// DiffSource is a source of changed files, local git or API of the
+	// provider
+	DiffSource string `yaml:"diffSource" hcl:"diff_source" json:"diffSource"`
+	// CommandTimeoutSeconds is a default timeout of checks and hooks, zero
+	// means no timeout
+	CommandTimeoutSeconds int `yaml:"commandTimeoutSeconds" hcl:"command_timeout_seconds" json:"commandTimeoutSeconds"`
+	// CommandLogDir is a directory output of checks and hooks is appended
+	// to, every command of the rule has its own file
+	CommandLogDir string `yaml:"commandLogDir" hcl:"command_log_dir" json:"commandLogDir"`
+	// CommandOutputLevel is a log level output of checks and hooks is
+	// logged with, debug by default as output can contain secrets
+	CommandOutputLevel string `yaml:"commandOutputLevel" hcl:"command_output_level" json:"commandOutputLevel"`
 }
 
 type ChecksConfig struct {
@@ -37,7 +73,11 @@ type HooksConfig struct {
 	PreProcess    map[string]*Command `yaml:"preProcess" hcl:"pre_process" json:"preProcess"`
 	PostCreateTag map[string]*Command `yaml:"postCreateTag" hcl:"post_create_tag" json:"postCreateTag"`
 	PostUpdateTag map[string]*Command `yaml:"postUpdateTag" hcl:"post_update_tag" json:"postUpdateTag"`
+	PostDeleteTag map[string]*Command `yaml:"postDeleteTag" hcl:"post_delete_tag" json:"postDeleteTag"`
 	PostProcess   map[string]*Command `yaml:"postProcess" hcl:"post_process" json:"postProcess"`
+	// OnCancel commands are run once if processing was stopped by
+	// termination signal
+	OnCancel map[string]*Command `yaml:"onCancel" hcl:"on_cancel" json:"onCancel"`
 }
 
 type Command struct {
@@ -46,6 +86,115 @@ type Command struct {
 	AllowFailure        bool         `yaml:"allowFailure" hcl:"allow_failure" json:"allowFailure"`
 	SkipOnFailure       bool         `yaml:"skipOnFailure" hcl:"skip_on_failure" json:"skipOnFailure"`
 	Command             []string     `yaml:"command" hcl:"command" json:"command"`
+	// Needs are commands of the same section to be run before, commands
+	// are ordered by Order and name otherwise
+	Needs []string `yaml:"needs" hcl:"needs" json:"needs"`
+	Order int      `yaml:"order" hcl:"order" json:"order"`
+	// TimeoutSeconds limits every attempt to run the command, it overrides
+	// CommandTimeoutSeconds of the config
+	TimeoutSeconds int `yaml:"timeoutSeconds" hcl:"timeout_seconds" json:"timeoutSeconds"`
+	// Capture stores stdout of the command as output of the rule
+	Capture *CaptureConfig `yaml:"capture" hcl:"capture" json:"capture"`
+}
+
+func (c *Config) Validate() error {
+	switch c.OnStaleRef {
+	case "", StaleRefSkip, StaleRefFail:
+	default:
+		return fmt.Errorf("unsupported onStaleRef value %q, must be %q or %q", c.OnStaleRef, StaleRefSkip, StaleRefFail)
+	}
+	if _, ok := forgeEnvironments[c.provider()]; !ok {
+		return fmt.Errorf("unsupported provider %q", c.Provider)
+	}
+	switch c.DiffSource {
+	case "", DiffSourceGit, DiffSourceAPI:
+	default:
+		return fmt.Errorf("unsupported diffSource value %q, must be %q or %q", c.DiffSource, DiffSourceGit, DiffSourceAPI)
+	}
+	if _, err := c.commandOutputLevel(); err != nil {
+		return fmt.Errorf("unsupported commandOutputLevel value %q: %v", c.CommandOutputLevel, err)
+	}
+	for _, section := range c.commandSections() {
+		if _, err := commandOrder(section.Commands); err != nil {
+			return fmt.Errorf("%s: %v", section.Name, err)
+		}
+		for name, command := range section.Commands {
+			if command == nil || command.Capture == nil {
+				continue
+			}
+			if section.WithoutRule {
+				return fmt.Errorf("%s: command '%s' can't capture output, it isn't run for a rule", section.Name, name)
+			}
+			if err := command.Capture.Validate(); err != nil {
+				return fmt.Errorf("%s: command '%s': %v", section.Name, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// commandSection is a named section of checks or hooks, WithoutRule is
+// true if commands of the section aren't run for a rule
+type commandSection struct {
+	Name        string
+	Commands    map[string]*Command
+	WithoutRule bool
+}
+
+func (c *Config) commandSections() []commandSection {
+	return []commandSection{
+		{"checks.preFlight", c.Checks.PreFlight, true},
+		{"checks.postFlight", c.Checks.PostFlight, true},
+		{"hooks.preProcess", c.Hooks.PreProcess, false},
+		{"hooks.postCreateTag", c.Hooks.PostCreateTag, false},
+		{"hooks.postUpdateTag", c.Hooks.PostUpdateTag, false},
+		{"hooks.postDeleteTag", c.Hooks.PostDeleteTag, false},
+		{"hooks.postProcess", c.Hooks.PostProcess, false},
+		{"hooks.onCancel", c.Hooks.OnCancel, true},
+	}
+}
+
+func (c *Config) provider() string {
+	if len(c.Provider) == 0 {
+		return GitLabForge
+	}
+	return c.Provider
+}
+
+func (c *Config) diffSource() string {
+	if len(c.DiffSource) == 0 {
+		return DiffSourceGit
+	}
+	return c.DiffSource
+}
+
+func (c *Config) commandOutputLevel() (logrus.Level, error) {
+	if len(c.CommandOutputLevel) == 0 {
+		return logrus.DebugLevel, nil
+	}
+	return logrus.ParseLevel(c.CommandOutputLevel)
+}
+
+func (c *Config) fetchDepthLimit() int {
+	if c.FetchDepthLimit == 0 {
+		return defaultFetchDepthLimit
+	}
+	return c.FetchDepthLimit
+}
+
+// commandTimeout returns timeout of the command attempt or zero
+func (c *Config) commandTimeout(command *Command) time.Duration {
+	if command.TimeoutSeconds > 0 {
+		return time.Duration(command.TimeoutSeconds) * time.Second
+	}
+	return time.Duration(c.CommandTimeoutSeconds) * time.Second
+}
+
+func (c *Config) gitRemote() string {
+	if len(c.GitRemote) == 0 {
+		return defaultGitRemote
+	}
+	return c.GitRemote
 }
 
 func DiscoverConfigFile(dir string) (string, error) {
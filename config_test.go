@@ -20,3 +20,69 @@ func TestDiscoverConfigFile(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	c := &Config{}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.OnStaleRef = StaleRefFail
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.OnStaleRef = "foobar"
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.OnStaleRef = ""
+	c.Provider = GiteaForge
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.Provider = "foobar"
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.Provider = ""
+	c.DiffSource = DiffSourceAPI
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.DiffSource = "foobar"
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.DiffSource = ""
+	c.CommandOutputLevel = "info"
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.CommandOutputLevel = "foobar"
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.CommandOutputLevel = ""
+	c.Hooks.PostUpdateTag = map[string]*Command{
+		"sync": {Needs: []string{"foobar"}},
+	}
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.Hooks.PostUpdateTag = map[string]*Command{
+		"sync": {Capture: &CaptureConfig{Name: "revision", Trim: true}},
+	}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c.Hooks.PostUpdateTag["sync"].Capture.Name = ""
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	c.Hooks.PostUpdateTag = nil
+	c.Checks.PreFlight = map[string]*Command{
+		"check": {Capture: &CaptureConfig{Name: "revision"}},
+	}
+	if err := c.Validate(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pathDependencyPrefix marks entry of dependsOn as a path pattern
+// explicitly, e.g. path:go.mod
+const pathDependencyPrefix = "path:"
+
+// isPathDependency reports whether entry of dependsOn is a path pattern:
+// it's marked with prefix or contains slash or wildcards
+func isPathDependency(dep string) bool {
+	return strings.HasPrefix(dep, pathDependencyPrefix) || strings.ContainsAny(dep, "/*?[{")
+}
+
+// ValidateDependencies checks that dependencies of rules are known rules
+// or path patterns and don't form a cycle
+func (t *Tracker) ValidateDependencies() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string, stack []string) error
+	visit = func(name string, stack []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(stack, " -> "), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range t.config.Rules[name].DependsOn {
+			if _, ok := t.config.Rules[dep]; !ok {
+				if isPathDependency(dep) {
+					continue
+				}
+				return fmt.Errorf("rule '%s' depends on unknown rule '%s', path patterns without slash must be prefixed with %q", name, dep, pathDependencyPrefix)
+			}
+			if err := visit(dep, append(stack, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	names := make([]string, 0, len(t.config.Rules))
+	for name := range t.config.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependencies returns direct and transitive dependencies of the rule,
+// rule names and path patterns in order of declaration
+func (t *Tracker) dependencies(rule *Rule) []string {
+	var (
+		result []string
+		seen   = make(map[string]bool)
+		walk   func(r *Rule)
+	)
+	walk = func(r *Rule) {
+		for _, dep := range r.DependsOn {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			result = append(result, dep)
+			if depRule, ok := t.config.Rules[dep]; ok {
+				walk(depRule)
+			}
+		}
+	}
+	walk(rule)
+	return result
+}
+
+// matchChanges returns files matched by the rule or by its dependencies and
+// dependencies which triggered the match
+func (t *Tracker) matchChanges(rule *Rule, changes []string) ([]string, []string, bool) {
+	matches, _ := rule.IsChangesMatch(changes)
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		seen[match] = true
+	}
+	var triggers []string
+	for _, dep := range t.dependencies(rule) {
+		depRule, ok := t.config.Rules[dep]
+		if !ok {
+			depRule = &Rule{
+				Name: rule.Name,
+				Path: strings.TrimPrefix(dep, pathDependencyPrefix),
+			}
+		}
+		depMatches, ok := depRule.IsChangesMatch(changes)
+		if !ok {
+			continue
+		}
+		triggers = append(triggers, dep)
+		for _, match := range depMatches {
+			if !seen[match] {
+				seen[match] = true
+				matches = append(matches, match)
+			}
+		}
+	}
+	if len(triggers) > 0 {
+		ruleLogger(rule).Debugf("Changed dependencies: %s.", strings.Join(triggers, ", "))
+	}
+	return matches, triggers, len(matches) > 0
+}
+
+// releaseDescription returns description of the release with stat of
+// changes and dependencies which triggered the update
+func releaseDescription(stat string, triggers []string, outputs map[string]string) string {
+	return dependenciesNote(triggers) + outputsNote(outputs) + fmt.Sprintf(descriptionTemplate, stat)
+}
+
+func dependenciesNote(triggers []string) string {
+	if len(triggers) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Triggered by changes of dependencies: %s\n\n", strings.Join(triggers, ", "))
+}
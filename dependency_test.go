@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	tracker := &Tracker{
+		config: Config{
+			Rules: map[string]*Rule{
+				"a": {DependsOn: []string{"b", "libs/**"}},
+				"b": {DependsOn: []string{"c"}},
+				"c": {},
+			},
+		},
+	}
+	if err := tracker.ValidateDependencies(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.config.Rules["c"].DependsOn = []string{"a"}
+	err := tracker.ValidateDependencies()
+	if err == nil {
+		t.Fatal("Must be an error, but got nil")
+	}
+	if err.Error() != "dependency cycle: a -> b -> c -> a" {
+		t.Errorf("Must be cycle a -> b -> c -> a, but got %v", err)
+	}
+	tracker.config.Rules["c"].DependsOn = []string{"path:go.mod", "*.proto"}
+	if err := tracker.ValidateDependencies(); err != nil {
+		t.Error(err)
+	}
+	tracker.config.Rules["c"].DependsOn = []string{"bb"}
+	if err := tracker.ValidateDependencies(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	tracker = &Tracker{}
+	if err := tracker.LoadRules("test_data/invalid_depends_on.yaml"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestMatchChanges(t *testing.T) {
+	tracker := &Tracker{
+		config: Config{
+			Rules: map[string]*Rule{
+				"app":    {Path: "services/app/**", DependsOn: []string{"common", "proto/**", "path:go.mod"}},
+				"common": {Path: "libs/common/**", DependsOn: []string{"base"}},
+				"base":   {Path: "libs/base/**"},
+			},
+		},
+	}
+	rule := tracker.config.Rules["app"]
+	tests := []struct {
+		changes  []string
+		matches  []string
+		triggers []string
+	}{
+		{
+			changes: []string{"services/other/main.go"},
+		},
+		{
+			changes: []string{"services/app/main.go"},
+			matches: []string{"services/app/main.go"},
+		},
+		{
+			changes:  []string{"libs/base/util.go", "proto/app.proto"},
+			matches:  []string{"libs/base/util.go", "proto/app.proto"},
+			triggers: []string{"base", "proto/**"},
+		},
+		{
+			changes:  []string{"libs/common/util.go", "libs/base/util.go"},
+			matches:  []string{"libs/common/util.go", "libs/base/util.go"},
+			triggers: []string{"common", "base"},
+		},
+		{
+			changes:  []string{"go.mod"},
+			matches:  []string{"go.mod"},
+			triggers: []string{"path:go.mod"},
+		},
+	}
+	for i, test := range tests {
+		matches, triggers, match := tracker.matchChanges(rule, test.changes)
+		if !reflect.DeepEqual(matches, test.matches) {
+			t.Errorf("%d. Must be %v, but got %v", i, test.matches, matches)
+		}
+		if !reflect.DeepEqual(triggers, test.triggers) {
+			t.Errorf("%d. Must be %v, but got %v", i, test.triggers, triggers)
+		}
+		if match != (len(test.matches) > 0) {
+			t.Errorf("%d. Must be %v, but got %v", i, len(test.matches) > 0, match)
+		}
+	}
+}
+
+func TestBuildPlan_Dependencies(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-dependencies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
+		config: Config{
+			Rules: map[string]*Rule{
+				"app": {
+					Path:      "app/**",
+					Tag:       "app",
+					DependsOn: []string{"lib"},
+				},
+				"lib": {
+					Path: "test_file",
+					Tag:  "lib",
+				},
+			},
+		},
+	}
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(repoDir, "test_file"), []byte(`image: foobar:2.0.0`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.beforeRef = commit
+	tracker.ref, err = le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := tracker.BuildPlan(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var descriptions []string
+	for _, action := range plan.Actions {
+		if action.Type == CreateReleasePlanAction && action.Tag == "app" {
+			descriptions = append(descriptions, action.Description)
+		}
+	}
+	if len(descriptions) != 1 || !strings.HasPrefix(descriptions[0], "Triggered by changes of dependencies: lib") {
+		t.Errorf("Must be release of app triggered by lib, but got %v", plan)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+const diffStatBarWidth = 50
+
+// countDiffLines returns number of added and deleted lines of unified diff,
+// lines before the first hunk are headers, e.g. "--- a/file", and aren't
+// counted even if they look like changes
+func countDiffLines(diff string) (additions, deletions int) {
+	scan := bufio.NewScanner(strings.NewReader(diff))
+	scan.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	inHunk := false
+	for scan.Scan() {
+		line := scan.Text()
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case strings.HasPrefix(line, "diff "):
+			// Headers of the next file if diff is complete
+			inHunk = false
+		case !inHunk:
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return
+}
+
+// formatDiffStat returns changes in the same format as git diff --stat
+func formatDiffStat(changes []*FileChange) string {
+	if len(changes) == 0 {
+		return ""
+	}
+	var (
+		width, maxTotal      int
+		additions, deletions int
+	)
+	for _, change := range changes {
+		if len(change.Path) > width {
+			width = len(change.Path)
+		}
+		if total := change.Additions + change.Deletions; total > maxTotal {
+			maxTotal = total
+		}
+		additions += change.Additions
+		deletions += change.Deletions
+	}
+	numWidth := len(fmt.Sprint(maxTotal))
+	var b strings.Builder
+	for _, change := range changes {
+		plus, minus := change.Additions, change.Deletions
+		if maxTotal > diffStatBarWidth {
+			plus = plus * diffStatBarWidth / maxTotal
+			minus = minus * diffStatBarWidth / maxTotal
+		}
+		fmt.Fprintf(&b, " %-*s | %*d %s%s\n", width, change.Path, numWidth, change.Additions+change.Deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+	fmt.Fprintf(&b, " %d %s changed", len(changes), plural(len(changes), "file", "files"))
+	if additions > 0 {
+		fmt.Fprintf(&b, ", %d %s(+)", additions, plural(additions, "insertion", "insertions"))
+	}
+	if deletions > 0 {
+		fmt.Fprintf(&b, ", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
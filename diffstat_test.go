@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestFormatDiffStat(t *testing.T) {
+	if stat := formatDiffStat(nil); stat != "" {
+		t.Errorf("Must be empty, but got %q", stat)
+	}
+	stat := formatDiffStat([]*FileChange{
+		{Path: "a.yaml", Additions: 100},
+		{Path: "dir/b.yaml", Additions: 10, Deletions: 40},
+	})
+	expected := " a.yaml     | 100 ++++++++++++++++++++++++++++++++++++++++++++++++++\n" +
+		" dir/b.yaml |  50 +++++--------------------\n" +
+		" 2 files changed, 110 insertions(+), 40 deletions(-)\n"
+	if stat != expected {
+		t.Errorf("Must be %q, but got %q", expected, stat)
+	}
+}
+
+func TestCountDiffLines(t *testing.T) {
+	additions, deletions := countDiffLines("--- a/file\n+++ b/file\n@@ -1,2 +1,2 @@\n context\n-old\n+new\n+more\n")
+	if additions != 2 || deletions != 1 {
+		t.Errorf("Must be 2 and 1, but got %d and %d", additions, deletions)
+	}
+	// Deleted "-- comment" and added "++counter" lines look like headers
+	additions, deletions = countDiffLines("@@ -1,2 +1,2 @@\n--- comment\n+++counter;\n context\n")
+	if additions != 1 || deletions != 1 {
+		t.Errorf("Must be 1 and 1, but got %d and %d", additions, deletions)
+	}
+	additions, deletions = countDiffLines("diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1 +1 @@\n-a\n+b\ndiff --git a/b b/b\n--- a/b\n+++ b/b\n@@ -0,0 +1 @@\n+c\n")
+	if additions != 2 || deletions != 1 {
+		t.Errorf("Must be 2 and 1, but got %d and %d", additions, deletions)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment describes build the tracker runs for. Non-empty fields
+// specified with command line flags override ones of the CI system.
+type Environment struct {
+	Ref       string
+	BeforeRef string
+	Project   string
+	APIURL    string
+}
+
+// merge replaces fields with non-empty fields of other
+func (e *Environment) merge(other Environment) {
+	if len(other.Ref) > 0 {
+		e.Ref = other.Ref
+	}
+	if len(other.BeforeRef) > 0 {
+		e.BeforeRef = other.BeforeRef
+	}
+	if len(other.Project) > 0 {
+		e.Project = other.Project
+	}
+	if len(other.APIURL) > 0 {
+		e.APIURL = other.APIURL
+	}
+}
+
+// ciAdapter reads Environment from variables of the CI system
+type ciAdapter struct {
+	Name string
+	// RefVar and ProjectVar are used in error messages, ref is resolved
+	// with git if RefVar is empty
+	RefVar     string
+	ProjectVar string
+	Detect     func() bool
+	Load       func() (Environment, error)
+}
+
+var (
+	gitlabCIAdapter = &ciAdapter{
+		Name:       "GitLab CI",
+		RefVar:     "CI_COMMIT_SHA",
+		ProjectVar: "CI_PROJECT_PATH",
+		Detect: func() bool {
+			// CI_COMMIT_SHA without GITLAB_CI is supported for backward
+			// compatibility
+			return len(os.Getenv("GITLAB_CI")) > 0 || len(os.Getenv("CI_COMMIT_SHA")) > 0
+		},
+		Load: func() (Environment, error) {
+			return Environment{
+				Ref:       os.Getenv("CI_COMMIT_SHA"),
+				BeforeRef: os.Getenv("CI_COMMIT_BEFORE_SHA"),
+				Project:   os.Getenv("CI_PROJECT_PATH"),
+			}, nil
+		},
+	}
+
+	githubActionsAdapter = &ciAdapter{
+		Name:       "GitHub Actions",
+		RefVar:     "GITHUB_SHA",
+		ProjectVar: "GITHUB_REPOSITORY",
+		Detect: func() bool {
+			return os.Getenv("GITHUB_ACTIONS") == "true"
+		},
+		Load: func() (Environment, error) {
+			env := Environment{
+				Ref:     os.Getenv("GITHUB_SHA"),
+				Project: os.Getenv("GITHUB_REPOSITORY"),
+			}
+			eventPath := os.Getenv("GITHUB_EVENT_PATH")
+			if len(eventPath) == 0 {
+				return env, nil
+			}
+			b, err := ioutil.ReadFile(eventPath)
+			if err != nil {
+				return env, err
+			}
+			// Only push event contains previous commit
+			event := struct {
+				Before string `json:"before"`
+			}{}
+			if err := json.Unmarshal(b, &event); err != nil {
+				return env, err
+			}
+			env.BeforeRef = event.Before
+			return env, nil
+		},
+	}
+
+	jenkinsAdapter = &ciAdapter{
+		Name:       "Jenkins",
+		RefVar:     "GIT_COMMIT",
+		ProjectVar: "GIT_URL",
+		Detect: func() bool {
+			return len(os.Getenv("JENKINS_URL")) > 0
+		},
+		Load: func() (Environment, error) {
+			before := os.Getenv("GIT_PREVIOUS_SUCCESSFUL_COMMIT")
+			if len(before) == 0 {
+				before = os.Getenv("GIT_PREVIOUS_COMMIT")
+			}
+			return Environment{
+				Ref:       os.Getenv("GIT_COMMIT"),
+				BeforeRef: before,
+				Project:   projectFromGitURL(os.Getenv("GIT_URL")),
+			}, nil
+		},
+	}
+
+	manualAdapter = &ciAdapter{
+		Name:       "manual",
+		ProjectVar: "-project flag",
+		Detect: func() bool {
+			return true
+		},
+		Load: func() (Environment, error) {
+			return Environment{}, nil
+		},
+	}
+
+	ciAdapters = []*ciAdapter{
+		gitlabCIAdapter,
+		githubActionsAdapter,
+		jenkinsAdapter,
+		manualAdapter,
+	}
+)
+
+// detectCIAdapter returns adapter of the CI system the tracker runs in,
+// manual one is used outside of known CI systems
+func detectCIAdapter() *ciAdapter {
+	for _, adapter := range ciAdapters {
+		if adapter.Detect() {
+			return adapter
+		}
+	}
+	return manualAdapter
+}
+
+// projectFromGitURL returns path of the project from URL of remote, e.g.
+// group/project for git@example.com:group/project.git
+func projectFromGitURL(gitURL string) string {
+	if len(gitURL) == 0 {
+		return ""
+	}
+	p := gitURL
+	if u, err := url.Parse(gitURL); err == nil && len(u.Scheme) > 0 {
+		p = u.Path
+	} else if i := strings.Index(gitURL, ":"); i >= 0 {
+		// scp-like syntax
+		p = gitURL[i+1:]
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	return p
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+var ciVars = []string{
+	"GITLAB_CI",
+	"CI_COMMIT_SHA",
+	"CI_COMMIT_BEFORE_SHA",
+	"CI_PROJECT_PATH",
+	"GITHUB_ACTIONS",
+	"GITHUB_SHA",
+	"GITHUB_REPOSITORY",
+	"GITHUB_EVENT_PATH",
+	"JENKINS_URL",
+	"GIT_COMMIT",
+	"GIT_PREVIOUS_COMMIT",
+	"GIT_PREVIOUS_SUCCESSFUL_COMMIT",
+	"GIT_URL",
+}
+
+func setCIVars(vars map[string]string) func() {
+	for _, v := range ciVars {
+		os.Unsetenv(v)
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for _, v := range ciVars {
+			os.Unsetenv(v)
+		}
+	}
+}
+
+func TestDetectCIAdapter(t *testing.T) {
+	tests := []struct {
+		vars    map[string]string
+		adapter *ciAdapter
+	}{
+		{
+			vars:    map[string]string{"GITLAB_CI": "true"},
+			adapter: gitlabCIAdapter,
+		},
+		{
+			vars:    map[string]string{"CI_COMMIT_SHA": "000"},
+			adapter: gitlabCIAdapter,
+		},
+		{
+			vars:    map[string]string{"GITHUB_ACTIONS": "true"},
+			adapter: githubActionsAdapter,
+		},
+		{
+			vars:    map[string]string{"JENKINS_URL": "http://jenkins"},
+			adapter: jenkinsAdapter,
+		},
+		{
+			adapter: manualAdapter,
+		},
+	}
+	for _, test := range tests {
+		cleanup := setCIVars(test.vars)
+		adapter := detectCIAdapter()
+		cleanup()
+		if adapter != test.adapter {
+			t.Errorf("%v. Must be %s, but got %s", test.vars, test.adapter.Name, adapter.Name)
+		}
+	}
+}
+
+func TestGitHubActionsAdapter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	eventPath := path.Join(dir, "event.json")
+	if err := ioutil.WriteFile(eventPath, []byte(`{"before": "000", "after": "111"}`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer setCIVars(map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_SHA":        "111",
+		"GITHUB_REPOSITORY": "owner/repo",
+		"GITHUB_EVENT_PATH": eventPath,
+	})()
+	env, err := githubActionsAdapter.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Environment{Ref: "111", BeforeRef: "000", Project: "owner/repo"}
+	if env != expected {
+		t.Errorf("Must be %v, but got %v", expected, env)
+	}
+	os.Setenv("GITHUB_EVENT_PATH", path.Join(dir, "not-found.json"))
+	if _, err := githubActionsAdapter.Load(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestJenkinsAdapter(t *testing.T) {
+	defer setCIVars(map[string]string{
+		"JENKINS_URL":         "http://jenkins",
+		"GIT_COMMIT":          "111",
+		"GIT_PREVIOUS_COMMIT": "000",
+		"GIT_URL":             "git@gitlab.example.com:group/project.git",
+	})()
+	env, err := jenkinsAdapter.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Environment{Ref: "111", BeforeRef: "000", Project: "group/project"}
+	if env != expected {
+		t.Errorf("Must be %v, but got %v", expected, env)
+	}
+}
+
+func TestProjectFromGitURL(t *testing.T) {
+	tests := map[string]string{
+		"": "",
+		"https://gitlab.example.com/group/project":         "group/project",
+		"https://gitlab.example.com/group/sub/project.git": "group/sub/project",
+		"git@github.com:owner/repo.git":                    "owner/repo",
+		"ssh://git@github.com:22/owner/repo.git":           "owner/repo",
+	}
+	for in, out := range tests {
+		if p := projectFromGitURL(in); p != out {
+			t.Errorf("%s. Must be %q, but got %q", in, out, p)
+		}
+	}
+}
+
+func TestLoadEnvironment_Manual(t *testing.T) {
+	defer setCIVars(nil)()
+	repoDir, err := ioutil.TempDir("", "tracker-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GITLAB_TOKEN", "token")
+	defer os.Unsetenv("GITLAB_TOKEN")
+	tracker := &Tracker{
+		dir: repoDir,
+		git: "git",
+		overrides: Environment{
+			BeforeRef: "000",
+			APIURL:    "https://gitlab.example.com/api/v4",
+		},
+	}
+	if err := tracker.LoadEnvironment(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	tracker.overrides.Project = "group/project"
+	if err := tracker.LoadEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if tracker.ref != commit {
+		t.Errorf("Must be %s, but got %s", commit, tracker.ref)
+	}
+	if tracker.beforeRef != "000" || tracker.proj != "group/project" {
+		t.Errorf("Must be overridden, but got %s and %s", tracker.beforeRef, tracker.proj)
+	}
+	if tracker.apiURL != tracker.overrides.APIURL {
+		t.Errorf("Must be %s, but got %s", tracker.overrides.APIURL, tracker.apiURL)
+	}
+	os.Setenv("CI_COMMIT_SHA", "111")
+	os.Setenv("CI_PROJECT_PATH", "group/another")
+	if err := tracker.LoadEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if tracker.ref != "111" || tracker.proj != "group/project" {
+		t.Errorf("Must be 111 of group/project, but got %s of %s", tracker.ref, tracker.proj)
+	}
+}
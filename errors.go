@@ -1,12 +1,17 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type ErrFailedCommandExecution struct {
 	Ignore      bool
 	CommandType CommandType
 	Name        string
 	Message     string
+	// Timeout is true if the last attempt was killed on timeout
+	Timeout bool
 }
 
 func IsIgnorableErrFailedCommandExecution(err error) bool {
@@ -24,3 +29,101 @@ func IsErrFailedCommandExecution(err error) bool {
 func (e ErrFailedCommandExecution) Error() string {
 	return fmt.Sprintf("%s %s: %s", e.CommandType, e.Name, e.Message)
 }
+
+// ErrCommandTimeout means that command was killed on timeout, Output is
+// the last lines of its output
+type ErrCommandTimeout struct {
+	Timeout time.Duration
+	Output  string
+}
+
+func IsErrCommandTimeout(err error) bool {
+	_, ok := err.(ErrCommandTimeout)
+	return ok
+}
+
+func (e ErrCommandTimeout) Error() string {
+	return fmt.Sprintf("timed out after %s: %s", e.Timeout, e.Output)
+}
+
+// ErrCanceled means that processing was stopped by termination signal, Err
+// is an error of processing if any
+type ErrCanceled struct {
+	Err error
+}
+
+func IsErrCanceled(err error) bool {
+	_, ok := err.(ErrCanceled)
+	return ok
+}
+
+func (e ErrCanceled) Error() string {
+	if e.Err == nil {
+		return "canceled"
+	}
+	return fmt.Sprintf("canceled: %v", e.Err)
+}
+
+// ErrTagMoveRolledBack means that tag was deleted, but can't be created at
+// new commit, so it was restored at previous one
+type ErrTagMoveRolledBack struct {
+	Tag  string
+	From string
+	To   string
+	Err  error
+}
+
+func IsErrTagMoveRolledBack(err error) bool {
+	_, ok := err.(ErrTagMoveRolledBack)
+	return ok
+}
+
+func (e ErrTagMoveRolledBack) Error() string {
+	return fmt.Sprintf("failed to move tag '%s' to %s, rolled back to %s: %v", e.Tag, e.To, e.From, e.Err)
+}
+
+type ForgeErrorKind string
+
+const (
+	TagNotFoundForgeError     ForgeErrorKind = "tag not found"
+	ProjectNotFoundForgeError ForgeErrorKind = "project not found"
+	ForbiddenForgeError       ForgeErrorKind = "forbidden"
+	RateLimitedForgeError     ForgeErrorKind = "rate limited"
+	ConflictForgeError        ForgeErrorKind = "conflict"
+)
+
+// ErrForge is an error of forge API classified by response status code
+type ErrForge struct {
+	Kind       ForgeErrorKind
+	StatusCode int
+	Message    string
+}
+
+// IsErrForge reports whether err is ErrForge of specified kind
+func IsErrForge(err error, kind ForgeErrorKind) bool {
+	if e, ok := err.(ErrForge); ok {
+		return e.Kind == kind
+	}
+	return false
+}
+
+func (e ErrForge) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s: %d %s", e.Kind, e.StatusCode, e.Message)
+}
+
+// ErrRulesFailed contains errors of failed rules by rule name
+type ErrRulesFailed struct {
+	Errors map[string]error
+}
+
+func IsErrRulesFailed(err error) bool {
+	_, ok := err.(ErrRulesFailed)
+	return ok
+}
+
+func (e ErrRulesFailed) Error() string {
+	return fmt.Sprintf("failed to process %d rule(s)", len(e.Errors))
+}
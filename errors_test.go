@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -44,3 +45,50 @@ func TestErrCommandExecutionFailed_Error(t *testing.T) {
 	}
 	assert.Equal(t, "PreFlight TEST: FooBar", err.Error())
 }
+
+func TestErrTagMoveRolledBack(t *testing.T) {
+	err := ErrTagMoveRolledBack{
+		Tag:  "foobar",
+		From: "000",
+		To:   "111",
+		Err:  errors.New("403 Forbidden"),
+	}
+	assert.Equal(t, true, IsErrTagMoveRolledBack(err))
+	assert.Equal(t, false, IsErrTagMoveRolledBack(errors.New("failed")))
+	assert.Equal(t, "failed to move tag 'foobar' to 111, rolled back to 000: 403 Forbidden", err.Error())
+}
+
+func TestErrForge(t *testing.T) {
+	err := ErrForge{
+		Kind:       ForbiddenForgeError,
+		StatusCode: 403,
+		Message:    "Forbidden",
+	}
+	assert.Equal(t, true, IsErrForge(err, ForbiddenForgeError))
+	assert.Equal(t, false, IsErrForge(err, TagNotFoundForgeError))
+	assert.Equal(t, false, IsErrForge(errors.New("403 Forbidden"), ForbiddenForgeError))
+	assert.Equal(t, "forbidden: 403 Forbidden", err.Error())
+	err.StatusCode = 0
+	assert.Equal(t, "forbidden: Forbidden", err.Error())
+}
+
+func TestErrRulesFailed(t *testing.T) {
+	err := ErrRulesFailed{
+		Errors: map[string]error{
+			"foobar": errors.New("failed"),
+		},
+	}
+	assert.Equal(t, true, IsErrRulesFailed(err))
+	assert.Equal(t, false, IsErrRulesFailed(errors.New("failed")))
+	assert.Equal(t, "failed to process 1 rule(s)", err.Error())
+}
+
+func TestErrCommandTimeout(t *testing.T) {
+	err := ErrCommandTimeout{
+		Timeout: time.Second,
+		Output:  "waiting",
+	}
+	assert.Equal(t, true, IsErrCommandTimeout(err))
+	assert.Equal(t, false, IsErrCommandTimeout(errors.New("timed out")))
+	assert.Equal(t, "timed out after 1s: waiting", err.Error())
+}
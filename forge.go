@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	GitLabForge = "gitlab"
+	GitHubForge = "github"
+	GiteaForge  = "gitea"
+	GitForge    = "git"
+
+	defaultGitHubAPIURL = "https://api.github.com"
+
+	// listTagsPageSize is a number of tags requested per page
+	listTagsPageSize = 100
+)
+
+// Tag is a provider-neutral representation of a tag
+type Tag struct {
+	Name    string
+	Message string
+	Commit  string
+}
+
+// Forge is a strict subset of operations with tags and releases of the
+// project hosted by GitLab, GitHub or Gitea. Errors of API are returned as
+// ErrForge when possible: GetTag and DeleteTag return TagNotFoundForgeError
+// for missing tag, CreateTag returns ConflictForgeError if tag exists.
+// ListTags returns all tags of the project.
+type Forge interface {
+	GetTag(name string) (*Tag, error)
+	ListTags() ([]*Tag, error)
+	CreateTag(name, ref, message string) (*Tag, error)
+	DeleteTag(name string) error
+	CreateRelease(tagName, description string) error
+}
+
+// FileChange is a changed file with number of added and deleted lines,
+// OldPath is a previous path of renamed or deleted file
+type FileChange struct {
+	Path      string
+	OldPath   string
+	Additions int
+	Deletions int
+}
+
+// Comparer is implemented by forges which can find changes and common
+// ancestor of commits without local git
+type Comparer interface {
+	Compare(from, to string) ([]*FileChange, error)
+	MergeBase(a, b string) (string, error)
+}
+
+// TagMatcher is implemented by forges which read tag messages with a
+// request per tag, only tags with names matched by match are returned
+type TagMatcher interface {
+	MatchTags(match func(name string) bool) ([]*Tag, error)
+}
+
+// ForgeEnvironment contains names of environment variables with credentials
+// of the provider and default value of API URL
+type ForgeEnvironment struct {
+	TokenVar      string
+	APIURLVar     string
+	APIURLDefault string
+}
+
+var (
+	forgeEnvironments = map[string]ForgeEnvironment{
+		GitLabForge: {
+			TokenVar:  "GITLAB_TOKEN",
+			APIURLVar: "CI_API_V4_URL",
+		},
+		GitHubForge: {
+			TokenVar:      "GITHUB_TOKEN",
+			APIURLVar:     "GITHUB_API_URL",
+			APIURLDefault: defaultGitHubAPIURL,
+		},
+		GiteaForge: {
+			TokenVar:  "GITEA_TOKEN",
+			APIURLVar: "GITEA_API_URL",
+		},
+		// Credentials of the remote are managed by git itself
+		GitForge: {},
+	}
+)
+
+// NewForge returns API client for the project of specified provider, see
+// gitForge for the plain git one
+func NewForge(provider, apiURL, token, project string) (Forge, error) {
+	switch provider {
+	case GitLabForge:
+		return newGitLabForge(apiURL, token, project)
+	case GitHubForge:
+		return &githubForge{
+			api:     newRestClient(apiURL, "token "+token),
+			project: project,
+		}, nil
+	case GiteaForge:
+		return &giteaForge{
+			api:     newRestClient(apiURL, "token "+token),
+			project: project,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported provider %q", provider)
+}
+
+// restError is a response of REST API with unexpected status code
+type restError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+func isRestStatus(err error, codes ...int) bool {
+	e, ok := err.(*restError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if e.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// existingTagConflict returns ErrForge if tag exists, it's used when API
+// doesn't respond with 409 status code on tag creation
+func existingTagConflict(f Forge, name string, err error) error {
+	if _, getErr := f.GetTag(name); getErr == nil {
+		return ErrForge{
+			Kind:    ConflictForgeError,
+			Message: err.Error(),
+		}
+	}
+	return err
+}
+
+// restClient is a minimal JSON REST API client used by GitHub and Gitea
+// providers
+type restClient struct {
+	client        *http.Client
+	baseURL       string
+	authorization string
+}
+
+func newRestClient(baseURL, authorization string) *restClient {
+	return &restClient{
+		client:        httpCli,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		authorization: authorization,
+	}
+}
+
+func (r *restClient) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	req, err := http.NewRequest(method, r.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", r.authorization)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &restError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(b)),
+		}
+	}
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// tagError converts error of tag endpoint to ErrForge, 404 means that tag
+// not found if project exists
+func (r *restClient) tagError(projectPath string, err error) error {
+	if isRestStatus(err, http.StatusNotFound) {
+		projectErr := r.do(http.MethodGet, projectPath, nil, nil)
+		if isRestStatus(projectErr, http.StatusNotFound) {
+			return restErrForge(projectErr, ProjectNotFoundForgeError)
+		}
+	}
+	return restErrForge(err, TagNotFoundForgeError)
+}
+
+// escapePath escapes every segment of the path, but keeps slashes
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// forgeErrorKind returns kind of error for response status code or empty
+// string if status code isn't classified, notFound is a kind used for 404
+func forgeErrorKind(statusCode int, notFound ForgeErrorKind) ForgeErrorKind {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ForbiddenForgeError
+	case http.StatusNotFound:
+		return notFound
+	case http.StatusConflict:
+		return ConflictForgeError
+	case http.StatusTooManyRequests:
+		return RateLimitedForgeError
+	}
+	return ""
+}
+
+// restErrForge converts restError to ErrForge if possible
+func restErrForge(err error, notFound ForgeErrorKind) error {
+	e, ok := err.(*restError)
+	if !ok {
+		return err
+	}
+	kind := forgeErrorKind(e.StatusCode, notFound)
+	if len(kind) == 0 {
+		return err
+	}
+	return ErrForge{
+		Kind:       kind,
+		StatusCode: e.StatusCode,
+		Message:    e.Message,
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultGitRemote = "origin"
+
+	gitForgeUserName  = "gitlab-tracker"
+	gitForgeUserEmail = "gitlab-tracker@localhost"
+)
+
+// gitForge manages tags in any remote with plain git, releases are
+// written as annotated tag bodies
+type gitForge struct {
+	git    func(arg ...string) *exec.Cmd
+	remote string
+}
+
+func (g *gitForge) run(arg ...string) (string, error) {
+	output, err := g.git(arg...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(arg, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// remoteCommit returns commit of the remote tag or empty string if tag not
+// found
+func (g *gitForge) remoteCommit(name string) (string, error) {
+	ref := "refs/tags/" + name
+	commits, err := g.remoteTags(ref, ref+"^{}")
+	if err != nil {
+		return "", err
+	}
+	return commits[name], nil
+}
+
+// remoteTags returns commits of remote tags matching patterns by names
+func (g *gitForge) remoteTags(patterns ...string) (map[string]string, error) {
+	output, err := g.run(append([]string{"ls-remote", "--tags", g.remote}, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+	commits := make(map[string]string)
+	scan := bufio.NewScanner(strings.NewReader(output))
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/tags/") {
+			continue
+		}
+		name := strings.TrimPrefix(fields[1], "refs/tags/")
+		if strings.HasSuffix(name, "^{}") {
+			// Annotated tag peeled to commit
+			commits[strings.TrimSuffix(name, "^{}")] = fields[0]
+		} else if _, ok := commits[name]; !ok {
+			commits[name] = fields[0]
+		}
+	}
+	return commits, nil
+}
+
+func (g *gitForge) GetTag(name string) (*Tag, error) {
+	commit, err := g.remoteCommit(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit) == 0 {
+		return nil, g.tagNotFound(name)
+	}
+	ref := "refs/tags/" + name
+	if _, err := g.run("fetch", "--no-tags", g.remote, "+"+ref+":"+ref); err != nil {
+		return nil, err
+	}
+	message, err := g.message(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{
+		Name:    name,
+		Message: message,
+		Commit:  commit,
+	}, nil
+}
+
+func (g *gitForge) ListTags() ([]*Tag, error) {
+	commits, err := g.remoteTags()
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, nil
+	}
+	if _, err := g.run("fetch", "--no-tags", g.remote, "+refs/tags/*:refs/tags/*"); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(commits))
+	for name := range commits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tags := make([]*Tag, 0, len(names))
+	for _, name := range names {
+		message, err := g.message(name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &Tag{
+			Name:    name,
+			Message: message,
+			Commit:  commits[name],
+		})
+	}
+	return tags, nil
+}
+
+// message returns message of the fetched tag, lightweight tag has no
+// message
+func (g *gitForge) message(name string) (string, error) {
+	output, err := g.run("for-each-ref", "--format=%(objecttype)%00%(contents)", "refs/tags/"+name)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(output, "\x00", 2)
+	if len(parts) == 2 && parts[0] == "tag" {
+		return strings.TrimRight(parts[1], "\n"), nil
+	}
+	return "", nil
+}
+
+func (g *gitForge) CreateTag(name, ref, message string) (*Tag, error) {
+	commit, err := g.remoteCommit(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit) > 0 {
+		return nil, ErrForge{
+			Kind:    ConflictForgeError,
+			Message: fmt.Sprintf("tag '%s' already exists in %s", name, g.remote),
+		}
+	}
+	if err := g.tag(name, ref, message); err != nil {
+		return nil, err
+	}
+	if _, err := g.run("push", g.remote, "refs/tags/"+name); err != nil {
+		return nil, err
+	}
+	return &Tag{
+		Name:    name,
+		Message: message,
+		Commit:  ref,
+	}, nil
+}
+
+func (g *gitForge) DeleteTag(name string) error {
+	commit, err := g.remoteCommit(name)
+	if err != nil {
+		return err
+	}
+	if len(commit) == 0 {
+		return g.tagNotFound(name)
+	}
+	if _, err := g.run("push", g.remote, ":refs/tags/"+name); err != nil {
+		return err
+	}
+	// Local tag is optional
+	g.run("tag", "-d", name)
+	return nil
+}
+
+func (g *gitForge) CreateRelease(tagName, description string) error {
+	tag, err := g.GetTag(tagName)
+	if err != nil {
+		return err
+	}
+	message := tag.Message + "\n\n" + description
+	if err := g.tag(tagName, tag.Commit, message); err != nil {
+		return err
+	}
+	_, err = g.run("push", "--force", g.remote, "refs/tags/"+tagName)
+	return err
+}
+
+func (g *gitForge) tagNotFound(name string) error {
+	return ErrForge{
+		Kind:    TagNotFoundForgeError,
+		Message: fmt.Sprintf("tag '%s' not found in %s", name, g.remote),
+	}
+}
+
+// tag creates or replaces local annotated tag, committer identity is
+// required, so it's specified if not configured
+func (g *gitForge) tag(name, ref, message string) error {
+	args := []string{"tag", "-f", "-a", name, "-F", "-", ref}
+	if _, err := g.run("config", "user.email"); err != nil {
+		args = append([]string{"-c", "user.name=" + gitForgeUserName, "-c", "user.email=" + gitForgeUserEmail}, args...)
+	}
+	cmd := g.git(args...)
+	cmd.Stdin = bytes.NewBufferString(message)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git tag %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
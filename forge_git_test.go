@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newGitForgeWorkspace returns tracker for a clone with pushed commit and
+// bare repository as its origin
+func newGitForgeWorkspace(t *testing.T) (*Tracker, *localExecutor, func()) {
+	dir, err := ioutil.TempDir("", "tracker-git-forge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteDir := path.Join(dir, "remote.git")
+	workDir := path.Join(dir, "work")
+	for _, d := range []string{remoteDir, workDir} {
+		if err := os.Mkdir(d, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := &localExecutor{remoteDir}
+	if _, err := remote.exec([]string{"git", "init", "--bare"}); err != nil {
+		t.Fatal(err)
+	}
+	le := &localExecutor{workDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := le.exec([]string{"git", "remote", "add", "origin", remoteDir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := le.exec([]string{"git", "push", "origin", "HEAD:refs/heads/master"}); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		git: "git",
+		dir: workDir,
+		ref: commit,
+	}
+	tracker.forge = &gitForge{
+		git:    tracker.gitCommand,
+		remote: defaultGitRemote,
+	}
+	return tracker, le, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGitForge(t *testing.T) {
+	tracker, _, cleanup := newGitForgeWorkspace(t)
+	defer cleanup()
+	forge := tracker.forge
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Fatalf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+	if _, err := forge.CreateTag("app@1.0.0", tracker.ref, tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := forge.GetTag("app@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != tracker.ref || tag.Message != tagMessage {
+		t.Fatalf("Must be app@1.0.0 at %s, but got %v", tracker.ref, tag)
+	}
+	tags, err := forge.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "app@1.0.0" || tags[0].Commit != tracker.ref || tags[0].Message != tagMessage {
+		t.Errorf("Must be app@1.0.0 at %s, but got %v", tracker.ref, tags)
+	}
+	// Remote tag must not be replaced
+	if _, err := tracker.gitCommand("tag", "-d", "app@1.0.0").CombinedOutput(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.CreateTag("app@1.0.0", tracker.ref, "Another message"); !IsErrForge(err, ConflictForgeError) {
+		t.Errorf("Must be %s, but got %v", ConflictForgeError, err)
+	}
+	if err := forge.CreateRelease("app@1.0.0", "Description"); err != nil {
+		t.Fatal(err)
+	}
+	tag, err = forge.GetTag("app@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tag.Message, tagMessage) || !strings.HasSuffix(tag.Message, "Description") {
+		t.Errorf("Must be message with description, but got %q", tag.Message)
+	}
+	if err := forge.DeleteTag("app@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := forge.DeleteTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+	if err := forge.CreateRelease("app@1.0.0", "Description"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestTrackerPipeline_GitForge(t *testing.T) {
+	tracker, le, cleanup := newGitForgeWorkspace(t)
+	defer cleanup()
+	tracker.config.Rules = map[string]*Rule{
+		"app": {
+			Path: "test_file",
+			Tag:  "app",
+			TagSuffixFileRef: &TagSuffixFileRef{
+				File:   "test_file",
+				RegExp: regexp.MustCompile(`foobar:(.+)`),
+			},
+		},
+	}
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	commit := tracker.ref
+	if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte("image: foobar:1.0.0\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.beforeRef = commit
+	ref, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.ref = ref
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := tracker.forge.GetTag("app@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != ref {
+		t.Errorf("Must be %s, but got %s", ref, tag.Commit)
+	}
+	if history := TagHistory(tag.Message); len(history) != 1 || history[0] != commit {
+		t.Errorf("Must be [%s], but got %v", commit, history)
+	}
+	if !strings.Contains(tag.Message, "test_file") {
+		t.Errorf("Message must contain release description, but got %q", tag.Message)
+	}
+}
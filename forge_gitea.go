@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type giteaForge struct {
+	api     *restClient
+	project string
+}
+
+type giteaTag struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Commit  struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+func (g *giteaForge) path(format string, a ...interface{}) string {
+	return fmt.Sprintf("/repos/%s", escapePath(g.project)) + fmt.Sprintf(format, a...)
+}
+
+func (g *giteaForge) GetTag(name string) (*Tag, error) {
+	tag := &giteaTag{}
+	err := g.api.do(http.MethodGet, g.path("/tags/%s", escapePath(name)), nil, tag)
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	return tag.convert(), nil
+}
+
+func (g *giteaForge) ListTags() ([]*Tag, error) {
+	var tags []*Tag
+	for page := 1; ; page++ {
+		var list []*giteaTag
+		err := g.api.do(http.MethodGet, g.path("/tags?limit=%d&page=%d", listTagsPageSize, page), nil, &list)
+		if err != nil {
+			return nil, restErrForge(err, ProjectNotFoundForgeError)
+		}
+		for _, tag := range list {
+			tags = append(tags, tag.convert())
+		}
+		if len(list) < listTagsPageSize {
+			return tags, nil
+		}
+	}
+}
+
+func (g *giteaForge) CreateTag(name, ref, message string) (*Tag, error) {
+	tag := &giteaTag{}
+	err := g.api.do(http.MethodPost, g.path("/tags"), map[string]string{
+		"tag_name": name,
+		"target":   ref,
+		"message":  message,
+	}, tag)
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	return tag.convert(), nil
+}
+
+func (g *giteaForge) DeleteTag(name string) error {
+	err := g.api.do(http.MethodDelete, g.path("/tags/%s", escapePath(name)), nil, nil)
+	if err != nil {
+		return g.api.tagError(g.path(""), err)
+	}
+	return nil
+}
+
+func (g *giteaForge) CreateRelease(tagName, description string) error {
+	err := g.api.do(http.MethodPost, g.path("/releases"), map[string]string{
+		"tag_name": tagName,
+		"name":     tagName,
+		"body":     description,
+	}, nil)
+	if err != nil {
+		return g.api.tagError(g.path(""), err)
+	}
+	return nil
+}
+
+func (t *giteaTag) convert() *Tag {
+	return &Tag{
+		Name:    t.Name,
+		Message: t.Message,
+		Commit:  t.Commit.SHA,
+	}
+}
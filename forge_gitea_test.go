@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// giteaStandIn serves Tags and Releases API of Gitea for owner/repo
+// repository
+func giteaStandIn(repo *standInRepo) http.Handler {
+	const prefix = "/api/v1/repos/owner/repo/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == strings.TrimSuffix(prefix, "/"):
+			writeJSON(w, http.StatusOK, map[string]string{})
+		case r.Method == http.MethodGet && strings.HasPrefix(p, "tags/"):
+			tag, ok := repo.tags[strings.TrimPrefix(p, "tags/")]
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, giteaTagJSON(tag))
+		case r.Method == http.MethodGet && p == "tags":
+			var tags []map[string]interface{}
+			for _, tag := range repo.sortedTags() {
+				tags = append(tags, giteaTagJSON(tag))
+			}
+			writeJSON(w, http.StatusOK, tags)
+		case r.Method == http.MethodPost && p == "tags":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			if _, ok := repo.tags[opts["tag_name"]]; ok {
+				writeJSON(w, http.StatusConflict, map[string]string{"message": "tag already exists"})
+				return
+			}
+			tag := &Tag{Name: opts["tag_name"], Message: opts["message"], Commit: opts["target"]}
+			repo.tags[tag.Name] = tag
+			writeJSON(w, http.StatusCreated, giteaTagJSON(tag))
+		case r.Method == http.MethodDelete && strings.HasPrefix(p, "tags/"):
+			name := strings.TrimPrefix(p, "tags/")
+			if _, ok := repo.tags[name]; !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+				return
+			}
+			delete(repo.tags, name)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && p == "releases":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			repo.releases[opts["tag_name"]] = opts["body"]
+			writeJSON(w, http.StatusCreated, map[string]string{"tag_name": opts["tag_name"]})
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		}
+	})
+}
+
+func giteaTagJSON(tag *Tag) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    tag.Name,
+		"message": tag.Message,
+		"commit": map[string]string{
+			"sha": tag.Commit,
+		},
+	}
+}
+
+func TestGiteaForge(t *testing.T) {
+	repo := newStandInRepo()
+	ts := httptest.NewServer(giteaStandIn(repo))
+	defer ts.Close()
+	forge, err := NewForge(GiteaForge, ts.URL+"/api/v1", "token", "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testForge(t, forge, repo)
+	forge, err = NewForge(GiteaForge, ts.URL+"/api/v1", "token", "owner/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, ProjectNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", ProjectNotFoundForgeError, err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type githubForge struct {
+	api     *restClient
+	project string
+}
+
+type githubObject struct {
+	SHA  string `json:"sha"`
+	Type string `json:"type"`
+}
+
+type githubRef struct {
+	Ref    string       `json:"ref"`
+	Object githubObject `json:"object"`
+}
+
+type githubTag struct {
+	SHA     string       `json:"sha,omitempty"`
+	Tag     string       `json:"tag"`
+	Message string       `json:"message"`
+	Object  githubObject `json:"object"`
+}
+
+func (g *githubForge) path(format string, a ...interface{}) string {
+	return fmt.Sprintf("/repos/%s", escapePath(g.project)) + fmt.Sprintf(format, a...)
+}
+
+func (g *githubForge) GetTag(name string) (*Tag, error) {
+	ref := &githubRef{}
+	err := g.api.do(http.MethodGet, g.path("/git/ref/tags/%s", escapePath(name)), nil, ref)
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	return g.tag(ref)
+}
+
+func (g *githubForge) ListTags() ([]*Tag, error) {
+	return g.MatchTags(nil)
+}
+
+// MatchTags lists tag refs page by page, commits of lightweight tags are
+// taken from the listing and annotated tags are read only if match is nil
+// or matches their names
+func (g *githubForge) MatchTags(match func(name string) bool) ([]*Tag, error) {
+	var tags []*Tag
+	for page := 1; ; page++ {
+		var refs []*githubRef
+		err := g.api.do(http.MethodGet, g.path("/git/matching-refs/tags?per_page=%d&page=%d", listTagsPageSize, page), nil, &refs)
+		if err != nil {
+			return nil, restErrForge(err, ProjectNotFoundForgeError)
+		}
+		for _, ref := range refs {
+			if match != nil && !match(strings.TrimPrefix(ref.Ref, "refs/tags/")) {
+				continue
+			}
+			tag, err := g.tag(ref)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, tag)
+		}
+		if len(refs) < listTagsPageSize {
+			return tags, nil
+		}
+	}
+}
+
+// tag returns tag the ref points to, message is read from annotated tag
+func (g *githubForge) tag(ref *githubRef) (*Tag, error) {
+	tag := &Tag{
+		Name:   strings.TrimPrefix(ref.Ref, "refs/tags/"),
+		Commit: ref.Object.SHA,
+	}
+	// Lightweight tag points to commit directly
+	if ref.Object.Type != "tag" {
+		return tag, nil
+	}
+	annotated := &githubTag{}
+	err := g.api.do(http.MethodGet, g.path("/git/tags/%s", ref.Object.SHA), nil, annotated)
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	tag.Message = annotated.Message
+	tag.Commit = annotated.Object.SHA
+	return tag, nil
+}
+
+func (g *githubForge) CreateTag(name, ref, message string) (*Tag, error) {
+	annotated := &githubTag{}
+	err := g.api.do(http.MethodPost, g.path("/git/tags"), &githubTag{
+		Tag:     name,
+		Message: message,
+		Object: githubObject{
+			SHA:  ref,
+			Type: "commit",
+		},
+	}, annotated)
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	err = g.api.do(http.MethodPost, g.path("/git/refs"), map[string]string{
+		"ref": "refs/tags/" + name,
+		"sha": annotated.SHA,
+	}, nil)
+	// GitHub responds with 422 Reference already exists
+	if isRestStatus(err, http.StatusUnprocessableEntity) {
+		return nil, existingTagConflict(g, name, err)
+	}
+	if err != nil {
+		return nil, g.api.tagError(g.path(""), err)
+	}
+	return &Tag{
+		Name:    name,
+		Message: message,
+		Commit:  ref,
+	}, nil
+}
+
+func (g *githubForge) DeleteTag(name string) error {
+	err := g.api.do(http.MethodDelete, g.path("/git/refs/tags/%s", escapePath(name)), nil, nil)
+	// GitHub responds with 422 Reference does not exist
+	if isRestStatus(err, http.StatusUnprocessableEntity) {
+		return ErrForge{
+			Kind:       TagNotFoundForgeError,
+			StatusCode: http.StatusUnprocessableEntity,
+			Message:    err.(*restError).Message,
+		}
+	}
+	if err != nil {
+		return g.api.tagError(g.path(""), err)
+	}
+	return nil
+}
+
+func (g *githubForge) CreateRelease(tagName, description string) error {
+	err := g.api.do(http.MethodPost, g.path("/releases"), map[string]string{
+		"tag_name": tagName,
+		"name":     tagName,
+		"body":     description,
+	}, nil)
+	if err != nil {
+		return g.api.tagError(g.path(""), err)
+	}
+	return nil
+}
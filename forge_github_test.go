@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// githubStandIn serves Git database and Releases API of GitHub for
+// owner/repo repository, tag objects are addressed by tag names
+func githubStandIn(repo *standInRepo) http.Handler {
+	const prefix = "/repos/owner/repo/"
+	pending := make(map[string]*Tag)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		if r.Header.Get("Authorization") != "token token" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+			return
+		}
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == strings.TrimSuffix(prefix, "/"):
+			writeJSON(w, http.StatusOK, map[string]string{})
+		case r.Method == http.MethodGet && strings.HasPrefix(p, "git/ref/tags/"):
+			tag, ok := repo.tags[strings.TrimPrefix(p, "git/ref/tags/")]
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"ref":    "refs/tags/" + tag.Name,
+				"object": map[string]string{"sha": "tag-" + tag.Name, "type": "tag"},
+			})
+		case r.Method == http.MethodGet && p == "git/matching-refs/tags":
+			tags := repo.sortedTags()
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			if perPage <= 0 {
+				perPage = 30
+			}
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page <= 0 {
+				page = 1
+			}
+			start, end := (page-1)*perPage, page*perPage
+			if start > len(tags) {
+				start = len(tags)
+			}
+			if end > len(tags) {
+				end = len(tags)
+			}
+			refs := []map[string]interface{}{}
+			for _, tag := range tags[start:end] {
+				refs = append(refs, map[string]interface{}{
+					"ref":    "refs/tags/" + tag.Name,
+					"object": map[string]string{"sha": "tag-" + tag.Name, "type": "tag"},
+				})
+			}
+			writeJSON(w, http.StatusOK, refs)
+		case r.Method == http.MethodGet && strings.HasPrefix(p, "git/tags/tag-"):
+			tag, ok := repo.tags[strings.TrimPrefix(p, "git/tags/tag-")]
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"sha":     "tag-" + tag.Name,
+				"tag":     tag.Name,
+				"message": tag.Message,
+				"object":  map[string]string{"sha": tag.Commit, "type": "commit"},
+			})
+		case r.Method == http.MethodPost && p == "git/tags":
+			var opts githubTag
+			json.NewDecoder(r.Body).Decode(&opts)
+			pending["tag-"+opts.Tag] = &Tag{Name: opts.Tag, Message: opts.Message, Commit: opts.Object.SHA}
+			writeJSON(w, http.StatusCreated, map[string]string{"sha": "tag-" + opts.Tag})
+		case r.Method == http.MethodPost && p == "git/refs":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			name := strings.TrimPrefix(opts["ref"], "refs/tags/")
+			if _, ok := repo.tags[name]; ok {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference already exists"})
+				return
+			}
+			repo.tags[name] = pending[opts["sha"]]
+			writeJSON(w, http.StatusCreated, map[string]string{"ref": opts["ref"]})
+		case r.Method == http.MethodDelete && strings.HasPrefix(p, "git/refs/tags/"):
+			name := strings.TrimPrefix(p, "git/refs/tags/")
+			if _, ok := repo.tags[name]; !ok {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference does not exist"})
+				return
+			}
+			delete(repo.tags, name)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && p == "releases":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			repo.releases[opts["tag_name"]] = opts["body"]
+			writeJSON(w, http.StatusCreated, map[string]string{"tag_name": opts["tag_name"]})
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		}
+	})
+}
+
+func TestGitHubForge(t *testing.T) {
+	repo := newStandInRepo()
+	ts := httptest.NewServer(githubStandIn(repo))
+	defer ts.Close()
+	forge, err := NewForge(GitHubForge, ts.URL, "token", "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testForge(t, forge, repo)
+	forge, err = NewForge(GitHubForge, ts.URL, "invalid", "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, ForbiddenForgeError) {
+		t.Errorf("Must be %s, but got %v", ForbiddenForgeError, err)
+	}
+	forge, err = NewForge(GitHubForge, ts.URL, "token", "owner/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, ProjectNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", ProjectNotFoundForgeError, err)
+	}
+}
+
+func TestGitHubForge_MatchTags(t *testing.T) {
+	repo := newStandInRepo()
+	for i := 0; i < listTagsPageSize+5; i++ {
+		name := fmt.Sprintf("app-%03d", i)
+		repo.tags[name] = &Tag{Name: name, Message: tagMessage, Commit: fmt.Sprintf("sha%d", i)}
+	}
+	var tagRequests int
+	handler := githubStandIn(repo)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/git/tags/") {
+			tagRequests++
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	forge, err := NewForge(GitHubForge, ts.URL, "token", "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := forge.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != listTagsPageSize+5 {
+		t.Errorf("Must be %d, but got %d", listTagsPageSize+5, len(tags))
+	}
+	last := tags[len(tags)-1]
+	if last.Name != "app-104" || last.Commit != "sha104" || last.Message != tagMessage {
+		t.Errorf("Must be app-104 tag, but got %+v", last)
+	}
+	tagRequests = 0
+	tags, err = forge.(TagMatcher).MatchTags(func(name string) bool {
+		return name == "app-000" || name == "app-101"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "app-000" || tags[1].Name != "app-101" {
+		t.Errorf("Must be app-000 and app-101 tags, but got %v", tags)
+	}
+	if tagRequests != 2 {
+		t.Errorf("Must be 2, but got %d", tagRequests)
+	}
+}
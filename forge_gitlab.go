@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+type gitlabForge struct {
+	client  gitlabClient
+	project string
+}
+
+func newGitLabForge(apiURL, token, project string) (Forge, error) {
+	cli := gitlab.NewClient(httpCli, token)
+	err := cli.SetBaseURL(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabForge{
+		client:  gitlabRealClient(*cli),
+		project: project,
+	}, nil
+}
+
+func (g *gitlabForge) GetTag(name string) (*Tag, error) {
+	tag, _, err := g.client.GetTag(g.project, name, nil)
+	if err != nil {
+		return nil, g.error(err)
+	}
+	return gitlabTag(tag), nil
+}
+
+func (g *gitlabForge) ListTags() ([]*Tag, error) {
+	opts := &gitlab.ListTagsOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: listTagsPageSize,
+		},
+	}
+	var tags []*Tag
+	for {
+		page, resp, err := g.client.ListTags(g.project, opts)
+		if err != nil {
+			return nil, g.errorWithNotFound(err, ProjectNotFoundForgeError)
+		}
+		for _, tag := range page {
+			tags = append(tags, gitlabTag(tag))
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return tags, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *gitlabForge) CreateTag(name, ref, message string) (*Tag, error) {
+	opts := &gitlab.CreateTagOptions{
+		TagName: gitlab.String(name),
+		Ref:     gitlab.String(ref),
+		Message: gitlab.String(message),
+	}
+	tag, _, err := g.client.CreateTag(g.project, opts, nil)
+	if err != nil {
+		// GitLab responds with 400 Tag already exists
+		if statusCode(err) == http.StatusBadRequest {
+			return nil, existingTagConflict(g, name, err)
+		}
+		return nil, g.error(err)
+	}
+	return gitlabTag(tag), nil
+}
+
+func (g *gitlabForge) DeleteTag(name string) error {
+	_, err := g.client.DeleteTag(g.project, name, nil)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+func (g *gitlabForge) CreateRelease(tagName, description string) error {
+	opts := &gitlab.CreateReleaseOptions{
+		Name:        gitlab.String(tagName),
+		TagName:     gitlab.String(tagName),
+		Description: gitlab.String(description),
+	}
+	_, _, err := g.client.CreateRelease(g.project, opts)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+func (g *gitlabForge) Compare(from, to string) ([]*FileChange, error) {
+	opts := &gitlab.CompareOptions{
+		From: gitlab.String(from),
+		To:   gitlab.String(to),
+		// Compare commits directly like git diff does
+		Straight: gitlab.Bool(true),
+	}
+	compare, _, err := g.client.Compare(g.project, opts)
+	if err != nil {
+		// 404 means that commit not found, it isn't classified
+		return nil, g.errorWithNotFound(err, "")
+	}
+	changes := make([]*FileChange, 0, len(compare.Diffs))
+	for _, diff := range compare.Diffs {
+		change := &FileChange{
+			Path: diff.NewPath,
+		}
+		if diff.OldPath != diff.NewPath {
+			change.OldPath = diff.OldPath
+		}
+		change.Additions, change.Deletions = countDiffLines(diff.Diff)
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func (g *gitlabForge) MergeBase(a, b string) (string, error) {
+	opts := &gitlab.MergeBaseOptions{
+		Ref: []string{a, b},
+	}
+	commit, _, err := g.client.MergeBase(g.project, opts)
+	if err != nil {
+		// 404 means that commit not found, it isn't classified
+		return "", g.errorWithNotFound(err, "")
+	}
+	return commit.ID, nil
+}
+
+// error converts response error to ErrForge, 404 means that tag not found
+// if project exists
+func (g *gitlabForge) error(err error) error {
+	return g.errorWithNotFound(err, TagNotFoundForgeError)
+}
+
+func (g *gitlabForge) errorWithNotFound(err error, notFound ForgeErrorKind) error {
+	code := statusCode(err)
+	if code == http.StatusNotFound {
+		_, _, projectErr := g.client.GetProject(g.project, nil)
+		if statusCode(projectErr) == http.StatusNotFound {
+			return ErrForge{
+				Kind:       ProjectNotFoundForgeError,
+				StatusCode: code,
+				Message:    projectErr.(*gitlab.ErrorResponse).Message,
+			}
+		}
+	}
+	kind := forgeErrorKind(code, notFound)
+	if len(kind) == 0 {
+		return err
+	}
+	return ErrForge{
+		Kind:       kind,
+		StatusCode: code,
+		Message:    err.(*gitlab.ErrorResponse).Message,
+	}
+}
+
+// statusCode returns status code of the GitLab response error or zero
+func statusCode(err error) int {
+	if e, ok := err.(*gitlab.ErrorResponse); ok && e.Response != nil {
+		return e.Response.StatusCode
+	}
+	return 0
+}
+
+func gitlabTag(tag *gitlab.Tag) *Tag {
+	t := &Tag{
+		Name:    tag.Name,
+		Message: tag.Message,
+	}
+	if tag.Commit != nil {
+		t.Commit = tag.Commit.ID
+	}
+	return t
+}
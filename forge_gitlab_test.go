@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gitlabStandIn serves Tags and Releases API of GitLab for ABCD project
+func gitlabStandIn(repo *standInRepo) http.Handler {
+	const prefix = "/api/v4/projects/ABCD/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == strings.TrimSuffix(prefix, "/"):
+			writeJSON(w, http.StatusOK, map[string]string{})
+		case r.Method == http.MethodGet && strings.HasPrefix(p, "repository/tags/"):
+			tag, ok := repo.tags[strings.TrimPrefix(p, "repository/tags/")]
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Tag Not Found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, gitlabTagJSON(tag))
+		case r.Method == http.MethodGet && p == "repository/tags":
+			var tags []map[string]interface{}
+			for _, tag := range repo.sortedTags() {
+				tags = append(tags, gitlabTagJSON(tag))
+			}
+			writeJSON(w, http.StatusOK, tags)
+		case r.Method == http.MethodPost && p == "repository/tags":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			if _, ok := repo.tags[opts["tag_name"]]; ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Tag already exists"})
+				return
+			}
+			tag := &Tag{Name: opts["tag_name"], Message: opts["message"], Commit: opts["ref"]}
+			repo.tags[tag.Name] = tag
+			writeJSON(w, http.StatusCreated, gitlabTagJSON(tag))
+		case r.Method == http.MethodDelete && strings.HasPrefix(p, "repository/tags/"):
+			name := strings.TrimPrefix(p, "repository/tags/")
+			if _, ok := repo.tags[name]; !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Tag Not Found"})
+				return
+			}
+			delete(repo.tags, name)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && p == "releases":
+			var opts map[string]string
+			json.NewDecoder(r.Body).Decode(&opts)
+			repo.releases[opts["tag_name"]] = opts["description"]
+			writeJSON(w, http.StatusCreated, map[string]string{"tag_name": opts["tag_name"]})
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+		}
+	})
+}
+
+func gitlabTagJSON(tag *Tag) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    tag.Name,
+		"message": tag.Message,
+		"commit": map[string]string{
+			"id": tag.Commit,
+		},
+	}
+}
+
+func TestGitLabForge(t *testing.T) {
+	repo := newStandInRepo()
+	ts := httptest.NewServer(gitlabStandIn(repo))
+	defer ts.Close()
+	forge, err := NewForge(GitLabForge, ts.URL+"/api/v4", "token", "ABCD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testForge(t, forge, repo)
+	forge, err = NewForge(GitLabForge, ts.URL+"/api/v4", "token", "EFGH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, ProjectNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", ProjectNotFoundForgeError, err)
+	}
+}
+
+func TestGitLabForge_Compare(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path == "/api/v4/projects/ABCD/repository/merge_base" {
+			refs := q["refs[]"]
+			if len(refs) != 2 || refs[1] == "222" {
+				writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"id": "000"})
+			return
+		}
+		if r.URL.Path != "/api/v4/projects/ABCD/repository/compare" || q.Get("from") != "000" || q.Get("to") != "111" || q.Get("straight") != "true" {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"diffs": []map[string]interface{}{
+				{
+					"old_path": "test_file",
+					"new_path": "test_file",
+					"diff":     "@@ -1 +1,2 @@\n-image: foobar:1.0.0\n+image: foobar:2.0.0\n+replicas: 2\n",
+				},
+				{
+					"old_path": "README.md",
+					"new_path": "README.md",
+					"diff":     "@@ -1 +0,0 @@\n-# foobar\n",
+				},
+				{
+					"old_path": "old/file",
+					"new_path": "new/file",
+				},
+			},
+		})
+	}))
+	defer ts.Close()
+	forge, err := NewForge(GitLabForge, ts.URL+"/api/v4", "token", "ABCD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: forge,
+		config: Config{
+			DiffSource: DiffSourceAPI,
+		},
+	}
+	changes, err := tracker.Diff("000", "111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changes, ",") != "test_file,README.md,new/file,old/file" {
+		t.Errorf("Must be test_file, README.md and both paths of renamed file, but got %v", changes)
+	}
+	stat, err := tracker.DiffStat("000", "111", []string{"test_file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := " test_file | 3 ++-\n 1 file changed, 2 insertions(+), 1 deletion(-)\n"
+	if stat != expected {
+		t.Errorf("Must be %q, but got %q", expected, stat)
+	}
+	if _, err := tracker.Diff("111", "222"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	if ok, err := tracker.IsAncestor("000", "111"); err != nil || !ok {
+		t.Errorf("Must be an ancestor, but got %v, %v", ok, err)
+	}
+	if ok, err := tracker.IsAncestor("111", "000"); err != nil || ok {
+		t.Errorf("Must not be an ancestor, but got %v, %v", ok, err)
+	}
+	if _, err := tracker.IsAncestor("000", "222"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	tracker.forge = &giteaForge{}
+	if _, err := tracker.Diff("000", "111"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
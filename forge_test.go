@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// standInRepo is an in-memory repository behind REST API stand-ins
+type standInRepo struct {
+	mu       sync.Mutex
+	tags     map[string]*Tag
+	releases map[string]string
+}
+
+func newStandInRepo() *standInRepo {
+	return &standInRepo{
+		tags:     make(map[string]*Tag),
+		releases: make(map[string]string),
+	}
+}
+
+// sortedTags returns tags of the repository ordered by name
+func (r *standInRepo) sortedTags() []*Tag {
+	names := make([]string, 0, len(r.tags))
+	for name := range r.tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tags := make([]*Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, r.tags[name])
+	}
+	return tags
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// testForge runs the same scenario against any provider
+func testForge(t *testing.T, forge Forge, repo *standInRepo) {
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Fatalf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+	tag, err := forge.CreateTag("app@1.0.0", "000", tagMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Name != "app@1.0.0" || tag.Commit != "000" {
+		t.Errorf("Must be app@1.0.0 at 000, but got %v", tag)
+	}
+	tag, err = forge.GetTag("app@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != "000" || tag.Message != tagMessage {
+		t.Fatalf("Must be app@1.0.0 at 000, but got %v", tag)
+	}
+	tags, err := forge.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "app@1.0.0" || tags[0].Commit != "000" || tags[0].Message != tagMessage {
+		t.Errorf("Must be app@1.0.0 at 000, but got %v", tags)
+	}
+	if _, err := forge.CreateTag("app@1.0.0", "111", tagMessage); !IsErrForge(err, ConflictForgeError) {
+		t.Errorf("Must be %s, but got %v", ConflictForgeError, err)
+	}
+	if err := forge.CreateRelease("app@1.0.0", "Description"); err != nil {
+		t.Error(err)
+	}
+	if repo.releases["app@1.0.0"] != "Description" {
+		t.Errorf("Must be Description, but got %q", repo.releases["app@1.0.0"])
+	}
+	if err := forge.DeleteTag("app@1.0.0"); err != nil {
+		t.Error(err)
+	}
+	if err := forge.DeleteTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+	if _, err := forge.GetTag("app@1.0.0"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+}
+
+func TestNewForge(t *testing.T) {
+	for _, provider := range []string{GitLabForge, GitHubForge, GiteaForge} {
+		_, err := NewForge(provider, "http://127.0.0.1", "token", "group/project")
+		if err != nil {
+			t.Errorf("%s: %v", provider, err)
+		}
+	}
+	if _, err := NewForge("foobar", "", "", ""); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	if p := escapePath("group/app@1.0.0 rc"); p != "group/app@1.0.0%20rc" {
+		t.Errorf("Must be group/app@1.0.0%%20rc, but got %s", p)
+	}
+}
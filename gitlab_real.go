@@ -14,6 +14,11 @@ func (g gitlabRealClient) CreateTag(pid interface{}, opt *gitlab.CreateTagOption
 	return g.Tags.CreateTag(pid, opt, options...)
 }
 
+// ListTags alias for Tags.ListTags
+func (g gitlabRealClient) ListTags(pid interface{}, opt *gitlab.ListTagsOptions, options ...gitlab.OptionFunc) ([]*gitlab.Tag, *gitlab.Response, error) {
+	return g.Tags.ListTags(pid, opt, options...)
+}
+
 // DeleteTag alias for Tags.DeleteTag
 func (g gitlabRealClient) DeleteTag(pid interface{}, tag string, options ...gitlab.OptionFunc) (*gitlab.Response, error) {
 	return g.Tags.DeleteTag(pid, tag, options...)
@@ -23,3 +28,18 @@ func (g gitlabRealClient) DeleteTag(pid interface{}, tag string, options ...gitl
 func (g gitlabRealClient) CreateRelease(pid interface{}, opts *gitlab.CreateReleaseOptions, options ...gitlab.OptionFunc) (*gitlab.Release, *gitlab.Response, error) {
 	return g.Releases.CreateRelease(pid, opts, options...)
 }
+
+// GetProject alias for Projects.GetProject
+func (g gitlabRealClient) GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.OptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	return g.Projects.GetProject(pid, opt, options...)
+}
+
+// Compare alias for Repositories.Compare
+func (g gitlabRealClient) Compare(pid interface{}, opt *gitlab.CompareOptions, options ...gitlab.OptionFunc) (*gitlab.Compare, *gitlab.Response, error) {
+	return g.Repositories.Compare(pid, opt, options...)
+}
+
+// MergeBase alias for Repositories.MergeBase
+func (g gitlabRealClient) MergeBase(pid interface{}, opt *gitlab.MergeBaseOptions, options ...gitlab.OptionFunc) (*gitlab.Commit, *gitlab.Response, error) {
+	return g.Repositories.MergeBase(pid, opt, options...)
+}
@@ -6,6 +6,10 @@ import "github.com/xanzy/go-gitlab"
 type gitlabClient interface {
 	GetTag(pid interface{}, tag string, options ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error)
 	CreateTag(pid interface{}, opt *gitlab.CreateTagOptions, options ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error)
+	ListTags(pid interface{}, opt *gitlab.ListTagsOptions, options ...gitlab.OptionFunc) ([]*gitlab.Tag, *gitlab.Response, error)
 	DeleteTag(pid interface{}, tag string, options ...gitlab.OptionFunc) (*gitlab.Response, error)
 	CreateRelease(pid interface{}, opts *gitlab.CreateReleaseOptions, options ...gitlab.OptionFunc) (*gitlab.Release, *gitlab.Response, error)
+	GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.OptionFunc) (*gitlab.Project, *gitlab.Response, error)
+	Compare(pid interface{}, opt *gitlab.CompareOptions, options ...gitlab.OptionFunc) (*gitlab.Compare, *gitlab.Response, error)
+	MergeBase(pid interface{}, opt *gitlab.MergeBaseOptions, options ...gitlab.OptionFunc) (*gitlab.Commit, *gitlab.Response, error)
 }
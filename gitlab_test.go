@@ -1,29 +1,50 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
 
 	"github.com/xanzy/go-gitlab"
 )
 
 type gitlabFake struct {
+	mu   *sync.Mutex
 	tags map[string]*gitlab.Tag
 }
 
+// gitlabError returns an error the same as go-gitlab does for response
+func gitlabError(statusCode int, message string) error {
+	return &gitlab.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: statusCode,
+			Request: &http.Request{
+				Method: http.MethodGet,
+				URL:    &url.URL{Path: "/api/v4/projects/ABCD"},
+			},
+		},
+		Message: message,
+	}
+}
+
 func (g gitlabFake) GetTag(_ interface{}, tag string, _ ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	t, ok := g.tags[tag]
 	if !ok {
-		return nil, nil, errors.New(errTagNotFound)
+		return nil, nil, gitlabError(http.StatusNotFound, "{message: 404 Tag Not Found}")
 	}
 	return t, nil, nil
 }
 
 func (g gitlabFake) CreateTag(_ interface{}, opts *gitlab.CreateTagOptions, _ ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	tagName := *opts.TagName
 	_, ok := g.tags[tagName]
 	if ok {
-		return nil, nil, fmt.Errorf("tag %q already exists", tagName)
+		return nil, nil, gitlabError(http.StatusBadRequest, "{message: Tag "+tagName+" already exists}")
 	}
 	tag := &gitlab.Tag{
 		Commit: &gitlab.Commit{
@@ -36,10 +57,27 @@ func (g gitlabFake) CreateTag(_ interface{}, opts *gitlab.CreateTagOptions, _ ..
 	return tag, nil, nil
 }
 
+func (g gitlabFake) ListTags(_ interface{}, _ *gitlab.ListTagsOptions, _ ...gitlab.OptionFunc) ([]*gitlab.Tag, *gitlab.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.tags))
+	for name := range g.tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tags := make([]*gitlab.Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, g.tags[name])
+	}
+	return tags, nil, nil
+}
+
 func (g gitlabFake) DeleteTag(_ interface{}, tag string, _ ...gitlab.OptionFunc) (*gitlab.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	_, ok := g.tags[tag]
 	if !ok {
-		return nil, errors.New(errTagNotFound)
+		return nil, gitlabError(http.StatusNotFound, "{message: 404 Tag Not Found}")
 	}
 	delete(g.tags, tag)
 	return nil, nil
@@ -49,8 +87,56 @@ func (g gitlabFake) CreateRelease(_ interface{}, _ *gitlab.CreateReleaseOptions,
 	return nil, nil, nil
 }
 
+func (g gitlabFake) GetProject(_ interface{}, _ *gitlab.GetProjectOptions, _ ...gitlab.OptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	return &gitlab.Project{}, nil, nil
+}
+
+func (g gitlabFake) Compare(_ interface{}, _ *gitlab.CompareOptions, _ ...gitlab.OptionFunc) (*gitlab.Compare, *gitlab.Response, error) {
+	return nil, nil, gitlabError(http.StatusNotFound, "{message: 404 Not Found}")
+}
+
+func (g gitlabFake) MergeBase(_ interface{}, _ *gitlab.MergeBaseOptions, _ ...gitlab.OptionFunc) (*gitlab.Commit, *gitlab.Response, error) {
+	return nil, nil, gitlabError(http.StatusNotFound, "{message: 404 Not Found}")
+}
+
 func NewFakeClient() gitlabClient {
 	return &gitlabFake{
+		mu:   &sync.Mutex{},
 		tags: make(map[string]*gitlab.Tag),
 	}
 }
+
+// gitlabFailingCreate fails to create tags pointing to failRef
+type gitlabFailingCreate struct {
+	gitlabClient
+	failRef string
+}
+
+func (g gitlabFailingCreate) CreateTag(pid interface{}, opts *gitlab.CreateTagOptions, options ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error) {
+	if *opts.Ref == g.failRef {
+		return nil, nil, gitlabError(http.StatusForbidden, "403 Forbidden")
+	}
+	return g.gitlabClient.CreateTag(pid, opts, options...)
+}
+
+func NewFakeForge() Forge {
+	return &gitlabForge{
+		client:  NewFakeClient(),
+		project: "ABCD",
+	}
+}
+
+// gitlabRacingCreate hides tag on the first lookup like if it was created
+// by concurrent pipeline right after lookup
+type gitlabRacingCreate struct {
+	gitlabClient
+	hidden map[string]bool
+}
+
+func (g *gitlabRacingCreate) GetTag(pid interface{}, tag string, options ...gitlab.OptionFunc) (*gitlab.Tag, *gitlab.Response, error) {
+	if !g.hidden[tag] {
+		g.hidden[tag] = true
+		return nil, nil, gitlabError(http.StatusNotFound, "{message: 404 Tag Not Found}")
+	}
+	return g.gitlabClient.GetTag(pid, tag, options...)
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// matrixItemKey is a name of dimension with items of the matrix
+	matrixItemKey = "Item"
+	// matrixItemNameKey is a field of object item used as its name
+	matrixItemNameKey = "name"
+	// legacyMatrixRuleName is a name of the rule expanded with global
+	// matrix and matrixFromDir options
+	legacyMatrixRuleName = "matrix"
+)
+
+// MatrixItem is an object item of the matrix, it's rendered in templates
+// as its name, fields are available as {{.Item.field}}
+type MatrixItem map[string]interface{}
+
+func (m MatrixItem) String() string {
+	return fmt.Sprint(m[matrixItemNameKey])
+}
+
+// newMatrixItem converts item of the matrix decoded from any of
+// configuration formats, plain string is an item with name only
+func newMatrixItem(v interface{}) (MatrixItem, error) {
+	item := MatrixItem{}
+	switch value := v.(type) {
+	case string:
+		item[matrixItemNameKey] = value
+		return item, nil
+	case MatrixItem:
+		return value, nil
+	case map[string]interface{}:
+		for k, v := range value {
+			item[k] = v
+		}
+	case map[interface{}]interface{}:
+		// YAML
+		for k, v := range value {
+			item[fmt.Sprint(k)] = v
+		}
+	case []map[string]interface{}:
+		// HCL decodes object as a list of objects
+		for _, m := range value {
+			for k, v := range m {
+				item[k] = v
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported matrix item %v, must be string or object", v)
+	}
+	if _, ok := item[matrixItemNameKey]; !ok {
+		return nil, fmt.Errorf("matrix item %v must have %s field", v, matrixItemNameKey)
+	}
+	return item, nil
+}
+
+// RuleMatrix expands rule into rules for every combination of values of
+// dimensions. Items and items of sources (FromDir, FromGlob, FromFile and
+// FromCommand) are values of Item dimension, items are strings or objects
+// with name field.
+type RuleMatrix struct {
+	Items   []interface{} `yaml:"items" hcl:"items" json:"items"`
+	FromDir string        `yaml:"fromDir" hcl:"from_dir" json:"fromDir"`
+	// FromGlob items are named by path segments matched by wildcards, e.g.
+	// foo for services/*/kustomization.yaml
+	FromGlob string `yaml:"fromGlob" hcl:"from_glob" json:"fromGlob"`
+	// FromFile is a YAML or JSON file with list of items
+	FromFile string `yaml:"fromFile" hcl:"from_file" json:"fromFile"`
+	// FromCommand items are non-empty lines of the command output
+	FromCommand []string            `yaml:"fromCommand" hcl:"from_command" json:"fromCommand"`
+	Filter      *MatrixFilter       `yaml:"filter" hcl:"filter" json:"filter"`
+	Dimensions  map[string][]string `yaml:"dimensions" hcl:"dimensions" json:"dimensions"`
+	// Include adds combinations, Exclude removes combinations matching all
+	// specified values
+	Include []map[string]string `yaml:"include" hcl:"include" json:"include"`
+	Exclude []map[string]string `yaml:"exclude" hcl:"exclude" json:"exclude"`
+
+	// sources are items of every source loaded by Combinations
+	sources []MatrixSource
+	// commandDir and commandTimeout are working directory and timeout of
+	// FromCommand, it isn't run if skipCommand is true
+	commandDir     string
+	commandTimeout time.Duration
+	skipCommand    bool
+}
+
+// MatrixFilter filters items of the matrix by name
+type MatrixFilter struct {
+	Include    string `yaml:"include" hcl:"include" json:"include"`
+	Exclude    string `yaml:"exclude" hcl:"exclude" json:"exclude"`
+	SkipHidden bool   `yaml:"skipHidden" hcl:"skip_hidden" json:"skipHidden"`
+}
+
+// MatrixSource describes items loaded from a source of the matrix,
+// Skipped source isn't loaded, e.g. command by validate
+type MatrixSource struct {
+	Rule    string
+	Source  string
+	Items   []string
+	Skipped bool
+}
+
+func (m *RuleMatrix) Clone() *RuleMatrix {
+	dest := &RuleMatrix{
+		Items:       append([]interface{}(nil), m.Items...),
+		FromDir:     m.FromDir,
+		FromGlob:    m.FromGlob,
+		FromFile:    m.FromFile,
+		FromCommand: append([]string(nil), m.FromCommand...),
+		Include:     cloneStringMaps(m.Include),
+		Exclude:     cloneStringMaps(m.Exclude),
+	}
+	if m.Filter != nil {
+		filter := *m.Filter
+		dest.Filter = &filter
+	}
+	if m.Dimensions != nil {
+		dest.Dimensions = make(map[string][]string, len(m.Dimensions))
+		for k, v := range m.Dimensions {
+			dest.Dimensions[k] = append([]string(nil), v...)
+		}
+	}
+	return dest
+}
+
+// Validate checks sources and filter of the matrix
+func (m *RuleMatrix) Validate() error {
+	if len(m.FromGlob) > 0 {
+		if _, err := filepath.Match(m.FromGlob, ""); err != nil {
+			return fmt.Errorf("invalid fromGlob '%s': %v", m.FromGlob, err)
+		}
+		if !strings.ContainsAny(m.FromGlob, "*?[") {
+			return fmt.Errorf("fromGlob '%s' must contain wildcards", m.FromGlob)
+		}
+	}
+	if m.FromCommand != nil && len(m.FromCommand) == 0 {
+		return errors.New("fromCommand must not be empty")
+	}
+	if m.Filter != nil {
+		if _, err := regexp.Compile(m.Filter.Include); err != nil {
+			return fmt.Errorf("invalid filter include '%s': %v", m.Filter.Include, err)
+		}
+		if _, err := regexp.Compile(m.Filter.Exclude); err != nil {
+			return fmt.Errorf("invalid filter exclude '%s': %v", m.Filter.Exclude, err)
+		}
+	}
+	return nil
+}
+
+// loadItems returns filtered items of every source and records them as
+// sources of the matrix
+func (m *RuleMatrix) loadItems() ([]interface{}, error) {
+	m.sources = nil
+	var items []interface{}
+	add := func(source string, sourceItems []MatrixItem) {
+		s := MatrixSource{Source: source}
+		for _, item := range sourceItems {
+			if !m.Filter.match(item.String()) {
+				continue
+			}
+			s.Items = append(s.Items, item.String())
+			items = append(items, item)
+		}
+		m.sources = append(m.sources, s)
+	}
+	if len(m.Items) > 0 {
+		var list []MatrixItem
+		for _, v := range m.Items {
+			item, err := newMatrixItem(v)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		add("items", list)
+	}
+	if len(m.FromDir) > 0 {
+		dirs, err := matrixDirs(m.FromDir)
+		if err != nil {
+			return nil, err
+		}
+		var list []MatrixItem
+		for _, dir := range dirs {
+			list = append(list, MatrixItem{matrixItemNameKey: dir})
+		}
+		add("fromDir "+m.FromDir, list)
+	}
+	if len(m.FromGlob) > 0 {
+		list, err := matrixGlob(m.FromGlob)
+		if err != nil {
+			return nil, err
+		}
+		add("fromGlob "+m.FromGlob, list)
+	}
+	if len(m.FromFile) > 0 {
+		list, err := matrixFile(m.FromFile)
+		if err != nil {
+			return nil, err
+		}
+		add("fromFile "+m.FromFile, list)
+	}
+	if len(m.FromCommand) > 0 && m.skipCommand {
+		m.sources = append(m.sources, MatrixSource{
+			Source:  "fromCommand " + strings.Join(m.FromCommand, " "),
+			Skipped: true,
+		})
+	} else if len(m.FromCommand) > 0 {
+		list, err := matrixCommand(m.FromCommand, m.commandDir, m.commandTimeout)
+		if err != nil {
+			return nil, err
+		}
+		add("fromCommand "+strings.Join(m.FromCommand, " "), list)
+	}
+	return items, nil
+}
+
+// Combinations returns combinations of values in deterministic order
+func (m *RuleMatrix) Combinations() ([]map[string]interface{}, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	dimensions := make(map[string][]interface{}, len(m.Dimensions)+1)
+	for k, values := range m.Dimensions {
+		for _, v := range values {
+			dimensions[k] = append(dimensions[k], v)
+		}
+	}
+	items, err := m.loadItems()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		if _, ok := dimensions[matrixItemKey]; ok {
+			return nil, fmt.Errorf("%s dimension can't be used with items or fromDir", matrixItemKey)
+		}
+		dimensions[matrixItemKey] = items
+	}
+	var combinations []map[string]interface{}
+	if len(dimensions) > 0 {
+		combinations = []map[string]interface{}{{}}
+	}
+	for _, key := range matrixKeys(dimensions) {
+		var next []map[string]interface{}
+		for _, combination := range combinations {
+			for _, value := range dimensions[key] {
+				c := make(map[string]interface{}, len(combination)+1)
+				for k, v := range combination {
+					c[k] = v
+				}
+				c[key] = value
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+	filtered := combinations[:0]
+	for _, combination := range combinations {
+		if !matrixExcluded(combination, m.Exclude) {
+			filtered = append(filtered, combination)
+		}
+	}
+	combinations = filtered
+	for _, include := range m.Include {
+		if len(include) == 0 {
+			continue
+		}
+		exists := false
+		for _, combination := range combinations {
+			if matrixName(combination) == matrixName(include) {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		combination := make(map[string]interface{}, len(include))
+		for k, v := range include {
+			combination[k] = v
+		}
+		if name, ok := include[matrixItemKey]; ok {
+			combination[matrixItemKey] = MatrixItem{matrixItemNameKey: name}
+		}
+		combinations = append(combinations, combination)
+	}
+	return combinations, nil
+}
+
+// matrixExcluded reports whether combination has all values of any entry
+func matrixExcluded(combination map[string]interface{}, exclude []map[string]string) bool {
+	for _, entry := range exclude {
+		if len(entry) == 0 {
+			continue
+		}
+		match := true
+		for k, v := range entry {
+			if value, ok := combination[k]; !ok || fmt.Sprint(value) != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// matrixKeys returns Item key first and other keys sorted
+func matrixKeys(values interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(values).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == matrixItemKey || keys[j] == matrixItemKey {
+			return keys[i] == matrixItemKey
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// matrixName returns name of the combination made of its values
+func matrixName(combination interface{}) string {
+	m := reflect.ValueOf(combination)
+	var values []string
+	for _, key := range matrixKeys(combination) {
+		values = append(values, fmt.Sprint(m.MapIndex(reflect.ValueOf(key)).Interface()))
+	}
+	return strings.Join(values, "-")
+}
+
+// matrixDirs returns names of directories in dir
+func matrixDirs(dir string) ([]string, error) {
+	fi, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, item := range fi {
+		if item.IsDir() {
+			dirs = append(dirs, item.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// match reports whether item with name passes the filter, nil filter
+// passes every item
+func (f *MatrixFilter) match(name string) bool {
+	if f == nil {
+		return true
+	}
+	if f.SkipHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+	// Expressions are checked by Validate
+	if len(f.Include) > 0 && !regexp.MustCompile(f.Include).MatchString(name) {
+		return false
+	}
+	if len(f.Exclude) > 0 && regexp.MustCompile(f.Exclude).MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// matrixGlob returns items for files matched by pattern, item is named by
+// path segments matched by wildcards joined with dash, fields are path of
+// the file and list of the segments
+func matrixGlob(pattern string) ([]MatrixItem, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternSegments := strings.Split(filepath.ToSlash(pattern), "/")
+	var items []MatrixItem
+	for _, match := range matches {
+		segments := strings.Split(filepath.ToSlash(match), "/")
+		var captures []string
+		for i, segment := range patternSegments {
+			if i < len(segments) && strings.ContainsAny(segment, "*?[") {
+				captures = append(captures, segments[i])
+			}
+		}
+		items = append(items, MatrixItem{
+			matrixItemNameKey: strings.Join(captures, "-"),
+			"path":            match,
+			"captures":        captures,
+		})
+	}
+	return items, nil
+}
+
+// matrixFile returns items listed in YAML or JSON file
+func matrixFile(filename string) ([]MatrixItem, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	// JSON is a subset of YAML
+	if err := yaml.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %v", filename, err)
+	}
+	var items []MatrixItem
+	for _, v := range list {
+		item, err := newMatrixItem(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse '%s': %v", filename, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// matrixCommand returns items for non-empty lines of the command output,
+// command is run in dir like hooks
+func matrixCommand(args []string, dir string, timeout time.Duration) ([]MatrixItem, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	cmd.Dir = dir
+	if err := RunCommand(context.Background(), cmd, timeout, &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("failed to execute '%s': %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	var items []MatrixItem
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			items = append(items, MatrixItem{matrixItemNameKey: line})
+		}
+	}
+	return items, nil
+}
+
+// PrintMatrixSources writes items of matrix sources as YAML comments
+func PrintMatrixSources(w io.Writer, sources []MatrixSource) error {
+	for _, source := range sources {
+		items := strings.Join(source.Items, ", ")
+		if source.Skipped {
+			items = "not expanded, command isn't run"
+		} else if len(items) == 0 {
+			items = "no items"
+		}
+		if _, err := fmt.Fprintf(w, "# Matrix of '%s' from %s: %s\n", source.Rule, source.Source, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateRulesWithMatrix replaces rules with matrix by rules generated for
+// every combination of the matrix. Generated rules are named by rule name
+// and values of combination, e.g. app-foo-production.
+func (t *Tracker) TemplateRulesWithMatrix() error {
+	rules := t.config.Rules
+	legacy := len(t.config.Matrix) > 0 || len(t.config.MatrixFromDir) > 0
+	if legacy {
+		matrixRule, ok := rules[legacyMatrixRuleName]
+		if !ok {
+			return errors.New("matrix can be used only with rule that named as `matrix`")
+		}
+		if matrixRule.Matrix != nil {
+			return errors.New("rule `matrix` can't declare its own matrix with global one")
+		}
+		matrixRule.Matrix = &RuleMatrix{
+			Items:   t.config.Matrix,
+			FromDir: t.config.MatrixFromDir,
+		}
+	}
+	t.matrixSources = nil
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parsedRules := make(map[string]*Rule, len(rules))
+	for _, name := range names {
+		rule := rules[name]
+		if rule.Matrix == nil {
+			parsedRules[name] = rule
+			continue
+		}
+		rule.Matrix.commandDir = t.dir
+		rule.Matrix.commandTimeout = time.Duration(t.config.CommandTimeoutSeconds) * time.Second
+		rule.Matrix.skipCommand = t.skipMatrixCommands
+		combinations, err := rule.Matrix.Combinations()
+		if err != nil {
+			return fmt.Errorf("matrix of '%s': %v", name, err)
+		}
+		for _, source := range rule.Matrix.sources {
+			source.Rule = name
+			t.matrixSources = append(t.matrixSources, source)
+		}
+		for _, combination := range combinations {
+			ref := rule.Clone()
+			ref.Matrix = nil
+			if err := ref.ParseAsTemplate(combination); err != nil {
+				return fmt.Errorf("matrix of '%s': %v", name, err)
+			}
+			ref.Values = combination
+			generated := name + "-" + matrixName(combination)
+			// Rules of global matrix are named by values only
+			if legacy && name == legacyMatrixRuleName {
+				generated = matrixName(combination)
+			}
+			_, generatedExists := parsedRules[generated]
+			if _, ok := rules[generated]; ok || generatedExists {
+				return fmt.Errorf("rule '%s' generated by matrix of '%s' already exists", generated, name)
+			}
+			parsedRules[generated] = ref
+		}
+	}
+	t.config.Rules = parsedRules
+	return nil
+}
+
+func cloneStringMaps(maps []map[string]string) []map[string]string {
+	if maps == nil {
+		return nil
+	}
+	dest := make([]map[string]string, 0, len(maps))
+	for _, m := range maps {
+		c := make(map[string]string, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		dest = append(dest, c)
+	}
+	return dest
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleMatrix_Combinations(t *testing.T) {
+	m := &RuleMatrix{
+		FromDir: "test_data/test_dir",
+		Dimensions: map[string][]string{
+			"Region": {"eu"},
+			"Env":    {"staging"},
+		},
+		Exclude: []map[string]string{
+			{"Item": "itemB"},
+		},
+	}
+	combinations, err := m.Combinations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range combinations {
+		names = append(names, matrixName(c))
+	}
+	expected := []string{"itemA-staging-eu", "itemC-staging-eu"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Must be %v, but got %v", expected, names)
+	}
+	m.Dimensions["Item"] = []string{"foo"}
+	if _, err := m.Combinations(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	m = &RuleMatrix{FromDir: "test_data/not-found"}
+	if _, err := m.Combinations(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	combinations, err = (&RuleMatrix{}).Combinations()
+	if err != nil || len(combinations) != 0 {
+		t.Errorf("Must be empty, but got %v, %v", combinations, err)
+	}
+}
+
+func TestTemplateRulesWithMatrix_Conflict(t *testing.T) {
+	tracker := &Tracker{
+		config: Config{
+			Rules: map[string]*Rule{
+				"app": {
+					Tag:    "{{.Item}}",
+					Matrix: &RuleMatrix{Items: []interface{}{"foo"}},
+				},
+				"app-foo": {
+					Tag: "foo",
+				},
+			},
+		},
+	}
+	if err := tracker.TemplateRulesWithMatrix(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestLoadRules_MatrixItems(t *testing.T) {
+	for _, filename := range []string{"valid_matrix_items.yaml", "valid_matrix_items.hcl", "valid_matrix_items.json"} {
+		tracker := &Tracker{}
+		if err := tracker.LoadRules("test_data/" + filename); err != nil {
+			t.Fatalf("%s. %v", filename, err)
+		}
+		rule, ok := tracker.config.Rules["app-billing"]
+		if !ok {
+			t.Fatalf("%s. Rule app-billing not found in %v", filename, tracker.config.Rules)
+		}
+		if rule.Tag != "payments-billing" {
+			t.Errorf("%s. Must be payments-billing, but got %s", filename, rule.Tag)
+		}
+		if rule.TagSuffixFileRef.RegExpRaw != "eu.gcr.io/x/billing:(.*)$" {
+			t.Errorf("%s. Must be eu.gcr.io/x/billing:(.*)$, but got %s", filename, rule.TagSuffixFileRef.RegExpRaw)
+		}
+		cmd, err := ProcessCommand(rule, []string{"kubectl", "-n", "{{.Item.namespace}}", "rollout", "restart", "{{.Item}}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"kubectl", "-n", "payments", "rollout", "restart", "billing"}
+		if !reflect.DeepEqual(cmd.Args, expected) {
+			t.Errorf("%s. Must be %v, but got %v", filename, expected, cmd.Args)
+		}
+	}
+}
+
+func TestNewMatrixItem(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		name  string
+		fail  bool
+	}{
+		{value: "foo", name: "foo"},
+		{value: map[string]interface{}{"name": "foo", "ns": "bar"}, name: "foo"},
+		{value: map[interface{}]interface{}{"name": "foo"}, name: "foo"},
+		{value: []map[string]interface{}{{"name": "foo"}}, name: "foo"},
+		{value: map[string]interface{}{"ns": "bar"}, fail: true},
+		{value: 1, fail: true},
+	}
+	for _, test := range tests {
+		item, err := newMatrixItem(test.value)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%v. Must be an error, but got nil", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v. %v", test.value, err)
+			continue
+		}
+		if item.String() != test.name {
+			t.Errorf("%v. Must be %s, but got %s", test.value, test.name, item)
+		}
+	}
+	rule := &Rule{Tag: "{{.Item.missing}}"}
+	if err := rule.ParseAsTemplate(map[string]interface{}{"Item": MatrixItem{"name": "foo"}}); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestLoadRules_MatrixSources(t *testing.T) {
+	tracker := &Tracker{}
+	if err := tracker.LoadRules("test_data/valid_matrix_sources.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range tracker.config.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	expected := []string{"command-foo", "file-billing", "file-web", "glob-billing", "glob-web"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Must be %v, but got %v", expected, names)
+	}
+	path := "test_data/matrix_sources/services/billing/kustomization.yaml"
+	if rule := tracker.config.Rules["glob-billing"]; rule.Path != path {
+		t.Errorf("Must be %s, but got %s", path, rule.Path)
+	}
+	buf := bytes.NewBufferString("")
+	if err := PrintMatrixSources(buf, tracker.matrixSources); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# Matrix of 'command' from fromCommand sh -c printf \"foo\\n\\nbar\\n\": foo\n",
+		"# Matrix of 'file' from fromFile test_data/matrix_sources/items.json: billing, web\n",
+		"# Matrix of 'glob' from fromGlob test_data/matrix_sources/services/*/kustomization.yaml: billing, web\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Must contain %q, but got %q", line, out)
+		}
+	}
+	// Commands aren't run by validate
+	tracker, err := LoadTracker(".", "test_data/valid_matrix_sources.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.config.Rules["command-foo"]; ok {
+		t.Error("Rule command-foo must not be generated")
+	}
+	buf.Reset()
+	if err := PrintMatrixSources(buf, tracker.matrixSources); err != nil {
+		t.Fatal(err)
+	}
+	line := "# Matrix of 'command' from fromCommand sh -c printf \"foo\\n\\nbar\\n\": not expanded, command isn't run\n"
+	if !strings.Contains(buf.String(), line) {
+		t.Errorf("Must contain %q, but got %q", line, buf.String())
+	}
+	if _, err := matrixCommand([]string{"sleep", "30"}, "", 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Must be timeout error, but got %v", err)
+	}
+}
+
+func TestRuleMatrix_Validate(t *testing.T) {
+	tests := []*RuleMatrix{
+		{FromGlob: "services/[/kustomization.yaml"},
+		{FromGlob: "services/foo/kustomization.yaml"},
+		{FromCommand: []string{}},
+		{Filter: &MatrixFilter{Include: "("}},
+		{Filter: &MatrixFilter{Exclude: "("}},
+	}
+	for _, m := range tests {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%v. Must be an error, but got nil", m)
+		}
+		if _, err := m.Combinations(); err == nil {
+			t.Errorf("%v. Must be an error, but got nil", m)
+		}
+	}
+	for _, m := range []*RuleMatrix{
+		{FromFile: "test_data/not-found.yaml"},
+		{FromFile: "test_data/invalid.json"},
+		{FromCommand: []string{"false"}},
+	} {
+		if _, err := m.Combinations(); err == nil {
+			t.Errorf("%v. Must be an error, but got nil", m)
+		}
+	}
+}
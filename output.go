@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// commandOutputTailLines is a number of the last lines of the command
+// output included in error message
+const commandOutputTailLines = 20
+
+var commandLogNameReplacer = strings.NewReplacer("/", "_", "\\", "_", " ", "_")
+
+// commandOutput streams output of the command to the logger line by line,
+// copies it to the log file if any and keeps the last lines. Every stream
+// of the command has its own buffer of incomplete line, so stdout and
+// stderr aren't mixed in one line.
+type commandOutput struct {
+	mu      sync.Mutex
+	logger  *logrus.Entry
+	level   logrus.Level
+	file    *os.File
+	fileErr error
+	streams []*commandStream
+	tail    []string
+}
+
+// commandStream is a stream of the command output, written data is copied
+// to capture if it's specified
+type commandStream struct {
+	output  *commandOutput
+	capture io.Writer
+	partial []byte
+}
+
+// Stream returns new stream of the output, written data is copied to
+// capture if it isn't nil
+func (o *commandOutput) Stream(capture io.Writer) io.Writer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := &commandStream{
+		output:  o,
+		capture: capture,
+	}
+	o.streams = append(o.streams, s)
+	return s
+}
+
+func (s *commandStream) Write(p []byte) (int, error) {
+	o := s.output
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if s.capture != nil {
+		if _, err := s.capture.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		o.line(string(s.partial[:i+1]))
+		s.partial = s.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// line logs the line and writes it to the log file, the line is terminated
+// by newline unless it's the last one
+func (o *commandOutput) line(line string) {
+	if o.file != nil {
+		// Failed log file must not break the command
+		if _, err := o.file.WriteString(line); err != nil {
+			o.fileErr = err
+			o.file.Close()
+			o.file = nil
+		}
+	}
+	line = strings.TrimRight(line, "\r\n")
+	o.logger.Log(o.level, line)
+	o.tail = append(o.tail, line)
+	if len(o.tail) > commandOutputTailLines {
+		o.tail = o.tail[1:]
+	}
+}
+
+// Close logs incomplete last lines of streams and closes the log file
+func (o *commandOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, s := range o.streams {
+		if len(s.partial) > 0 {
+			o.line(string(s.partial))
+			s.partial = nil
+		}
+	}
+	err := o.fileErr
+	if o.file != nil {
+		if closeErr := o.file.Close(); err == nil {
+			err = closeErr
+		}
+		o.file = nil
+	}
+	return err
+}
+
+// Tail returns the last lines of the output
+func (o *commandOutput) Tail() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return strings.Join(o.tail, "\n")
+}
+
+// commandOutput returns output of the command logged with rule, type and
+// name of the command, output is appended to the log file in
+// CommandLogDir if it's specified. Failed log file must not break the
+// command, output is only logged then.
+func (t *Tracker) commandOutput(commandType CommandType, name string, rule *Rule) *commandOutput {
+	// Level is checked by Config.Validate
+	level, _ := t.config.commandOutputLevel()
+	output := &commandOutput{
+		logger: ruleLogger(rule).WithFields(logrus.Fields{
+			"type": commandType,
+			"hook": name,
+		}),
+		level: level,
+	}
+	if len(t.config.CommandLogDir) == 0 {
+		return output
+	}
+	if err := os.MkdirAll(t.config.CommandLogDir, os.ModePerm); err != nil {
+		ruleLogger(rule).Warningf("Failed to create log directory of %s command %s: %v", commandType, name, err)
+		return output
+	}
+	filename := path.Join(t.config.CommandLogDir, commandLogName(commandType, name, rule))
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		ruleLogger(rule).Warningf("Failed to open log of %s command %s: %v", commandType, name, err)
+		return output
+	}
+	output.file = f
+	return output
+}
+
+// commandLogName returns name of the log file, e.g. app.PostUpdateTag.sync.log
+func commandLogName(commandType CommandType, name string, rule *Rule) string {
+	parts := []string{string(commandType), name}
+	if rule != nil && len(rule.Name) > 0 {
+		parts = append([]string{rule.Name}, parts...)
+	}
+	return commandLogNameReplacer.Replace(strings.Join(parts, ".")) + ".log"
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCommandOutput(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	output := &commandOutput{
+		logger: logger.WithField("hook", "foobar"),
+		level:  logrus.InfoLevel,
+	}
+	stream := output.Stream(nil)
+	fmt.Fprint(stream, "foo\nba")
+	fmt.Fprint(stream, "r\r\nbaz")
+	if len(hook.AllEntries()) != 2 {
+		t.Errorf("Must be 2 lines, but got %d", len(hook.AllEntries()))
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["hook"] != "foobar" || entry.Level != logrus.InfoLevel {
+			t.Errorf("Must be info of foobar hook, but got %v", entry)
+		}
+		lines = append(lines, entry.Message)
+	}
+	if strings.Join(lines, ",") != "foo,bar,baz" {
+		t.Errorf("Must be foo, bar and baz, but got %v", lines)
+	}
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(stream, "line %d\n", i)
+	}
+	tail := strings.Split(output.Tail(), "\n")
+	if len(tail) != commandOutputTailLines || tail[0] != "line 10" || tail[len(tail)-1] != "line 29" {
+		t.Errorf("Must be the last %d lines, but got %v", commandOutputTailLines, tail)
+	}
+}
+
+func TestCommandOutput_Streams(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	output := &commandOutput{
+		logger: logger.WithField("hook", "foobar"),
+		level:  logrus.InfoLevel,
+	}
+	captured := bytes.NewBufferString("")
+	stdout := output.Stream(captured)
+	stderr := output.Stream(nil)
+	fmt.Fprint(stdout, "foo")
+	fmt.Fprint(stderr, "err\n")
+	fmt.Fprint(stdout, "bar\nbaz")
+	fmt.Fprint(stderr, "warning")
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, entry := range hook.AllEntries() {
+		lines = append(lines, entry.Message)
+	}
+	if strings.Join(lines, ",") != "err,foobar,baz,warning" {
+		t.Errorf("Must be err, foobar, baz and warning, but got %v", lines)
+	}
+	if captured.String() != "foobar\nbaz" {
+		t.Errorf("Must be stdout only, but got %q", captured.String())
+	}
+}
+
+func TestExecCommandMap_Output(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tracker := &Tracker{
+		config: Config{
+			CommandLogDir: path.Join(dir, "logs"),
+		},
+	}
+	// Stdout and stderr are read concurrently, the pause keeps order of lines
+	commands := map[string]*Command{
+		"fail": {
+			Command:     []string{"sh", "-c", "echo out; sleep 0.1; echo err >&2; exit 1"},
+			RetryConfig: &RetryConfig{Maximum: 1},
+		},
+	}
+	err = tracker.ExecCommandMap(PostUpdateTagCommandType, commands, &Rule{Name: "app/foo"})
+	if !IsErrFailedCommandExecution(err) {
+		t.Fatalf("Must be failed command error, but got %v", err)
+	}
+	if !strings.HasSuffix(err.Error(), "exit status 1: out\nerr") {
+		t.Errorf("Must contain output, but got %q", err.Error())
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "logs", "app_foo.PostUpdateTag.fail.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "out\nerr\n" {
+		t.Errorf("Must be out and err, but got %q", string(b))
+	}
+}
+
+func TestExecCommandMap_InvalidLogDir(t *testing.T) {
+	f, err := ioutil.TempFile("", "tracker-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	tracker := &Tracker{
+		config: Config{
+			CommandLogDir: path.Join(f.Name(), "logs"),
+		},
+	}
+	commands := map[string]*Command{
+		"touch": {
+			Command: []string{"touch", f.Name() + ".touched"},
+		},
+	}
+	defer os.Remove(f.Name() + ".touched")
+	if err := tracker.ExecCommandMap(PostUpdateTagCommandType, commands, &Rule{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Name() + ".touched"); err != nil {
+		t.Errorf("Command must be executed: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type PlanActionType string
+
+const (
+	CreateTagPlanAction     PlanActionType = "CreateTag"
+	MoveTagPlanAction       PlanActionType = "MoveTag"
+	RunCommandPlanAction    PlanActionType = "RunCommand"
+	CreateReleasePlanAction PlanActionType = "CreateRelease"
+	DeleteTagPlanAction     PlanActionType = "DeleteTag"
+)
+
+// PlanAction describes a single change that Tracker.Run would make
+type PlanAction struct {
+	Type PlanActionType `json:"type"`
+	// Rule is a name of the rule the action is done for, it's empty for
+	// checks and hooks run without rule
+	Rule        string      `json:"rule,omitempty"`
+	Tag         string      `json:"tag,omitempty"`
+	From        string      `json:"from,omitempty"`
+	Ref         string      `json:"ref,omitempty"`
+	CommandType CommandType `json:"commandType,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	Command     []string    `json:"command,omitempty"`
+	Changes     []string    `json:"changes,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// Plan is a list of actions collected in plan mode instead of being executed
+type Plan struct {
+	mu      sync.Mutex
+	Actions []*PlanAction `json:"actions"`
+}
+
+func (p *Plan) Add(action *PlanAction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, action)
+}
+
+// Sort groups actions by rules, so plan doesn't depend on order rules
+// processed concurrently in. Actions without rule (e.g. checks) stay in
+// place, actions of every rule keep their order.
+func (p *Plan) Sort() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := 0
+	for i := 0; i <= len(p.Actions); i++ {
+		if i < len(p.Actions) && len(p.Actions[i].Rule) > 0 {
+			continue
+		}
+		group := p.Actions[start:i]
+		sort.SliceStable(group, func(a, b int) bool {
+			return group[a].Rule < group[b].Rule
+		})
+		start = i + 1
+	}
+}
+
+func (p *Plan) JSON() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return json.MarshalIndent(p, "", "  ")
+}
+
+func (p *Plan) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.Actions) == 0 {
+		return "No changes."
+	}
+	buf := bytes.NewBufferString("")
+	for i, action := range p.Actions {
+		if len(action.Rule) > 0 {
+			fmt.Fprintf(buf, "%d. [%s] %s\n", i+1, action.Rule, action)
+		} else {
+			fmt.Fprintf(buf, "%d. %s\n", i+1, action)
+		}
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (a *PlanAction) String() string {
+	switch a.Type {
+	case CreateTagPlanAction:
+		return fmt.Sprintf("Create tag '%s' at %s", a.Tag, a.Ref)
+	case MoveTagPlanAction:
+		return fmt.Sprintf("Move tag '%s' from %s to %s (%s)", a.Tag, a.From, a.Ref, strings.Join(a.Changes, ", "))
+	case DeleteTagPlanAction:
+		return fmt.Sprintf("Delete tag '%s' at %s", a.Tag, a.From)
+	case RunCommandPlanAction:
+		return fmt.Sprintf("Run %s command %s: %s", a.CommandType, a.Name, strings.Join(a.Command, " "))
+	case CreateReleasePlanAction:
+		return fmt.Sprintf("Create release '%s':\n%s", a.Tag, indent(a.Description, "   "))
+	}
+	return string(a.Type)
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
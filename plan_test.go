@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
+		config: Config{
+			Hooks: HooksConfig{
+				PostUpdateTag: map[string]*Command{
+					"sync": {
+						Command: []string{"not-found-binary", "{{.TagWithSuffix}}"},
+						Capture: &CaptureConfig{Name: "revision"},
+					},
+				},
+			},
+			Rules: map[string]*Rule{
+				"foobar": {
+					Path: "test_file",
+					Tag:  "foobar",
+				},
+			},
+		},
+	}
+	plan, err := tracker.BuildPlan(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Type != CreateTagPlanAction {
+		t.Fatalf("Must be single %s action, but got %v", CreateTagPlanAction, plan)
+	}
+	if _, err := tracker.forge.GetTag("foobar"); err == nil {
+		t.Fatal("Plan must not create tags")
+	}
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(repoDir, "test_file"), []byte(`image: foobar:2.0.0`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.beforeRef = commit
+	tracker.ref, err = le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = tracker.BuildPlan(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []PlanActionType{MoveTagPlanAction, RunCommandPlanAction, CreateReleasePlanAction}
+	if len(plan.Actions) != len(types) {
+		t.Fatalf("Must be %d actions, but got %v", len(types), plan)
+	}
+	for i, typ := range types {
+		if plan.Actions[i].Type != typ {
+			t.Errorf("%d. Must be %s, but got %s", i, typ, plan.Actions[i].Type)
+		}
+	}
+	if plan.Actions[0].From != commit || plan.Actions[0].Ref != tracker.ref {
+		t.Errorf("Must be move from %s to %s, but got %s", commit, tracker.ref, plan.Actions[0])
+	}
+	if strings.Join(plan.Actions[1].Command, " ") != "not-found-binary foobar" {
+		t.Errorf("Must be rendered command, but got %v", plan.Actions[1].Command)
+	}
+	if !strings.Contains(plan.Actions[2].Description, "test_file") {
+		t.Errorf("Release description must contain changed file, but got %q", plan.Actions[2].Description)
+	}
+	if !strings.Contains(plan.Actions[2].Description, "revision: <output of sync>") {
+		t.Errorf("Release description must contain captured output, but got %q", plan.Actions[2].Description)
+	}
+	if !strings.HasSuffix(plan.Actions[2].Description, "</code></pre></details>") {
+		t.Errorf("Must be description of the release, but got %q", plan.Actions[2].Description)
+	}
+	for _, action := range plan.Actions {
+		if action.Rule != "foobar" {
+			t.Errorf("Must be action of foobar rule, but got %q", action.Rule)
+		}
+	}
+	tag, err := tracker.forge.GetTag("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != commit {
+		t.Errorf("Plan must not move tags, but got %s", tag.Commit)
+	}
+	b, err := plan.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Plan{}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Actions) != len(types) {
+		t.Errorf("Must be %d actions, but got %d", len(types), len(decoded.Actions))
+	}
+	if len(plan.String()) == 0 {
+		t.Error("Must be non-empty text")
+	}
+}
+
+func TestBuildPlan_Run(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(repoDir, "test_file"), []byte(`image: foobar:2.0.0`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forge := NewFakeForge()
+	if _, err := forge.CreateTag("foobar", commit, tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge:     forge,
+		git:       "git",
+		ref:       ref,
+		beforeRef: commit,
+		dir:       repoDir,
+		config: Config{
+			Hooks: HooksConfig{
+				PostUpdateTag: map[string]*Command{
+					"sync": {
+						Command: []string{"echo", "synced"},
+						Capture: &CaptureConfig{Name: "revision", Trim: true},
+					},
+				},
+				PostProcess: map[string]*Command{
+					"notify": {
+						Command:     []string{"echo", "{{.Outputs.revision}}"},
+						RetryConfig: &RetryConfig{Maximum: 1},
+					},
+				},
+			},
+			Rules: map[string]*Rule{
+				"foobar": {
+					Path: "test_file",
+					Tag:  "foobar",
+				},
+			},
+		},
+	}
+	if _, err := tracker.BuildPlan(false); err != nil {
+		t.Fatal(err)
+	}
+	// Tag is moved by another pipeline, so sync hook isn't run and its
+	// planned output must not be used
+	if err := forge.DeleteTag("foobar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forge.CreateTag("foobar", ref, tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tracker.beforeRef = ref
+	if err := tracker.Run(false); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	if value, ok := tracker.config.Rules["foobar"].Outputs["revision"]; ok {
+		t.Errorf("Output must not be set, but got %q", value)
+	}
+}
+
+func TestPlan_Sort(t *testing.T) {
+	plan := &Plan{}
+	for _, action := range []*PlanAction{
+		{Type: RunCommandPlanAction, Name: "pre-flight"},
+		{Type: MoveTagPlanAction, Rule: "b", Tag: "b"},
+		{Type: MoveTagPlanAction, Rule: "a", Tag: "a"},
+		{Type: CreateReleasePlanAction, Rule: "b", Tag: "b"},
+		{Type: CreateReleasePlanAction, Rule: "a", Tag: "a"},
+		{Type: RunCommandPlanAction, Name: "post-flight"},
+	} {
+		plan.Add(action)
+	}
+	plan.Sort()
+	var steps []string
+	for _, action := range plan.Actions {
+		steps = append(steps, action.Rule+string(action.Type)+action.Name)
+	}
+	expected := "RunCommandpre-flight,aMoveTag,aCreateRelease,bMoveTag,bCreateRelease,RunCommandpost-flight"
+	if strings.Join(steps, ",") != expected {
+		t.Errorf("Must be %s, but got %s", expected, strings.Join(steps, ","))
+	}
+}
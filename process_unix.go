@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes command a leader of new process group, so it can
+// be killed with its children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to started command and its children
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup kills started command and its children
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, process groups aren't supported
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills started command, signals aren't supported
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killProcessGroup kills started command only
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
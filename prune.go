@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Prune deletes tags created by the tracker which don't belong to any of
+// the rules anymore, e.g. tags of removed matrix items, and runs
+// post_delete_tag hooks for them
+func (t *Tracker) Prune() error {
+	return t.handleCancel(t.prune())
+}
+
+func (t *Tracker) prune() error {
+	tags, err := t.listTags()
+	if err != nil {
+		return err
+	}
+	failed := make(map[string]error)
+	for _, tag := range t.OrphanTags(tags) {
+		if t.canceled() {
+			return ErrCanceled{}
+		}
+		rule := t.orphanTagRule(tag)
+		err := t.deleteOrphanTag(tag, rule)
+		if err == nil {
+			continue
+		}
+		if IsIgnorableErrFailedCommandExecution(err) {
+			ruleLogger(rule).Debug(err)
+			continue
+		}
+		if IsErrCanceled(err) {
+			t.logRuleError(rule, err)
+			return err
+		}
+		failed[tag.Name] = err
+		t.logRuleError(rule, err)
+	}
+	if len(failed) > 0 {
+		return ErrRulesFailed{Errors: failed}
+	}
+	return nil
+}
+
+// listTags returns tags of the forge, only tags which don't belong to any
+// rule are read by forges with expensive listing of tags
+func (t *Tracker) listTags() ([]*Tag, error) {
+	if matcher, ok := t.forge.(TagMatcher); ok {
+		return matcher.MatchTags(func(name string) bool {
+			return !t.isRuleTag(name)
+		})
+	}
+	return t.forge.ListTags()
+}
+
+// BuildPrunePlan collects actions of Prune instead of executing them
+func (t *Tracker) BuildPrunePlan() (*Plan, error) {
+	t.plan = &Plan{}
+	defer func() {
+		t.plan = nil
+	}()
+	plan := t.plan
+	err := t.Prune()
+	plan.Sort()
+	return plan, err
+}
+
+// OrphanTags returns tags marked by the tracker which names don't match
+// tag of any rule with or without suffix
+func (t *Tracker) OrphanTags(tags []*Tag) []*Tag {
+	var orphans []*Tag
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Message, tagMessage) {
+			continue
+		}
+		if !t.isRuleTag(tag.Name) {
+			orphans = append(orphans, tag)
+		}
+	}
+	return orphans
+}
+
+func (t *Tracker) isRuleTag(name string) bool {
+	for _, rule := range t.config.Rules {
+		if len(rule.Tag) == 0 {
+			continue
+		}
+		separator := rule.TagSuffixSeparator
+		if len(separator) == 0 {
+			separator = defaultTagSuffixSeparator
+		}
+		if name == rule.Tag || strings.HasPrefix(name, rule.Tag+separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanTagRule returns rule the hooks of orphan tag are rendered with,
+// tag is split by the first of suffix separators of configured rules found
+// in its name
+func (t *Tracker) orphanTagRule(tag *Tag) *Rule {
+	name := tag.Name
+	for _, separator := range t.tagSuffixSeparators() {
+		if i := strings.Index(tag.Name, separator); i > 0 {
+			name = tag.Name[:i]
+			break
+		}
+	}
+	return &Rule{
+		Name:          tag.Name,
+		Tag:           name,
+		TagWithSuffix: tag.Name,
+	}
+}
+
+// tagSuffixSeparators returns distinct suffix separators of the rules,
+// longer ones first as more specific
+func (t *Tracker) tagSuffixSeparators() []string {
+	seen := map[string]bool{}
+	var separators []string
+	for _, rule := range t.config.Rules {
+		separator := rule.TagSuffixSeparator
+		if len(separator) == 0 {
+			separator = defaultTagSuffixSeparator
+		}
+		if !seen[separator] {
+			seen[separator] = true
+			separators = append(separators, separator)
+		}
+	}
+	if len(separators) == 0 {
+		separators = append(separators, defaultTagSuffixSeparator)
+	}
+	sort.Slice(separators, func(i, j int) bool {
+		if len(separators[i]) != len(separators[j]) {
+			return len(separators[i]) > len(separators[j])
+		}
+		return separators[i] < separators[j]
+	})
+	return separators
+}
+
+func (t *Tracker) deleteOrphanTag(tag *Tag, rule *Rule) error {
+	if t.plan != nil {
+		t.plan.Add(&PlanAction{
+			Type: DeleteTagPlanAction,
+			Rule: rule.Name,
+			Tag:  tag.Name,
+			From: tag.Commit,
+		})
+	} else {
+		logrus.Infof("Delete orphan '%s' tag at %s.", tag.Name, tag.Commit)
+		err := t.forge.DeleteTag(tag.Name)
+		// Hooks were run by the one deleted the tag
+		if IsErrForge(err, TagNotFoundForgeError) {
+			logrus.Warningf("Tag '%s' was deleted concurrently, hooks are skipped.", tag.Name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return t.ExecCommandMap(PostDeleteTagCommandType, t.config.Hooks.PostDeleteTag, rule)
+}
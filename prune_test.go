@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	forge := NewFakeForge()
+	for name, message := range map[string]string{
+		"app@1.0.0":     tagMessage,
+		"apple@1.0.0":   tagMessage,
+		"billing-2.0.0": TagMessageWithHistory([]string{"000"}),
+		"payments-3.0":  tagMessage,
+		"web":           tagMessage,
+		"manual":        "Release",
+	} {
+		if _, err := forge.CreateTag(name, "000", message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracker := &Tracker{
+		forge: forge,
+		config: Config{
+			Rules: map[string]*Rule{
+				"app": {
+					Tag: "app",
+				},
+				"billing": {
+					Tag:                "billing",
+					TagSuffixSeparator: "-",
+				},
+			},
+			Hooks: HooksConfig{
+				PostDeleteTag: map[string]*Command{
+					"argocd": {
+						Command: []string{"echo", "{{.Tag}}", "{{.TagWithSuffix}}"},
+					},
+				},
+			},
+		},
+	}
+	plan, err := tracker.BuildPrunePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "1. [apple@1.0.0] Delete tag 'apple@1.0.0' at 000\n" +
+		"2. [apple@1.0.0] Run PostDeleteTag command argocd: echo apple apple@1.0.0\n" +
+		"3. [payments-3.0] Delete tag 'payments-3.0' at 000\n" +
+		"4. [payments-3.0] Run PostDeleteTag command argocd: echo payments payments-3.0\n" +
+		"5. [web] Delete tag 'web' at 000\n" +
+		"6. [web] Run PostDeleteTag command argocd: echo web web"
+	if plan.String() != expected {
+		t.Errorf("Must be %q, but got %q", expected, plan.String())
+	}
+	if err := tracker.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := forge.ListTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	expectedNames := []string{"app@1.0.0", "billing-2.0.0", "manual"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Must be %v, but got %v", expectedNames, names)
+	}
+	tracker.config.Hooks.PostDeleteTag["argocd"].Command = []string{"false"}
+	if _, err := forge.CreateTag("web", "000", tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Prune(); !IsErrRulesFailed(err) {
+		t.Errorf("Must be rules failed error, but got %v", err)
+	}
+}
+
+// deletedTagForge reports tags as deleted concurrently
+type deletedTagForge struct {
+	Forge
+}
+
+func (f deletedTagForge) DeleteTag(string) error {
+	return ErrForge{Kind: TagNotFoundForgeError}
+}
+
+func TestPrune_DeletedConcurrently(t *testing.T) {
+	forge := NewFakeForge()
+	if _, err := forge.CreateTag("web", "000", tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: deletedTagForge{Forge: forge},
+		config: Config{
+			Hooks: HooksConfig{
+				PostDeleteTag: map[string]*Command{
+					"argocd": {
+						Command: []string{"false"},
+					},
+				},
+			},
+		},
+	}
+	if err := tracker.Prune(); err != nil {
+		t.Errorf("Hooks must be skipped, but got %v", err)
+	}
+}
@@ -43,13 +43,17 @@ func (s *Stats) Break() {
 	s.breakNext = true
 }
 
-func Retry(callback func(*Stats) error, config *RetryConfig) error {
+// Retry calls callback until it succeeds or attempts are over, config
+// isn't modified as it can be shared by concurrent calls
+func Retry(callback func(*Stats) error, retryConfig *RetryConfig) error {
 	var err error
-	if config == nil {
-		config = &RetryConfig{
-			Maximum:  5,
-			Interval: time.Second,
-		}
+	config := &RetryConfig{
+		Maximum:  5,
+		Interval: time.Second,
+	}
+	if retryConfig != nil {
+		c := *retryConfig
+		config = &c
 	}
 
 	if config.Maximum == 0 && !config.Forever {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -83,3 +84,24 @@ func TestRetry(t *testing.T) {
 		Forever:  true,
 	})
 }
+
+func TestRetry_SharedConfig(t *testing.T) {
+	config := &RetryConfig{
+		Increment:       true,
+		IntervalSeconds: 1,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Retry(func(s *Stats) error {
+				return nil
+			}, config)
+		}()
+	}
+	wg.Wait()
+	if config.Maximum != 0 || config.Interval != 0 || config.IntervalMaximum != 0 {
+		t.Errorf("Config must not be modified, but got %+v", config)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tagHistoryPrefix = "Previous-Commit: "
+	tagHistoryLimit  = 10
+)
+
+// TagHistory returns previous commits of the tag recorded in its message,
+// the most recent one goes first
+func TagHistory(message string) []string {
+	var history []string
+	scan := bufio.NewScanner(strings.NewReader(message))
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if strings.HasPrefix(line, tagHistoryPrefix) {
+			history = append(history, strings.TrimPrefix(line, tagHistoryPrefix))
+		}
+	}
+	return history
+}
+
+// TagMessageWithHistory returns tag message with recorded previous commits
+func TagMessageWithHistory(history []string) string {
+	if len(history) == 0 {
+		return tagMessage
+	}
+	if len(history) > tagHistoryLimit {
+		history = history[:tagHistoryLimit]
+	}
+	lines := []string{tagMessage, ""}
+	for _, commit := range history {
+		lines = append(lines, tagHistoryPrefix+commit)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Rollback moves tag of the rule (or tag with specified name) back to the
+// commit, or to the previous position if commit is empty
+func (t *Tracker) Rollback(name, commit string, steps int) error {
+	return t.handleCancel(t.rollback(name, commit, steps))
+}
+
+func (t *Tracker) rollback(name, commit string, steps int) error {
+	rule, err := t.findRuleForRollback(name)
+	if err != nil {
+		return err
+	}
+	tag, err := t.forge.GetTag(rule.TagWithSuffix)
+	if err != nil {
+		return err
+	}
+	history := TagHistory(tag.Message)
+	if len(commit) > 0 {
+		history = rollbackHistoryTo(tag, history, commit)
+	} else {
+		if steps < 1 {
+			return errors.New("number of steps must be positive")
+		}
+		if steps > len(history) {
+			return fmt.Errorf("only %d previous commits of '%s' tag are known", len(history), tag.Name)
+		}
+		commit = history[steps-1]
+		history = history[steps:]
+	}
+	if commit == tag.Commit {
+		return fmt.Errorf("tag '%s' already points to %s", tag.Name, commit)
+	}
+	logrus.Infof("Rollback '%s' tag from %s to %s.", tag.Name, tag.Commit, commit)
+	err = t.moveTag(tag, commit, TagMessageWithHistory(history), true)
+	if err != nil {
+		return err
+	}
+	return t.ExecCommandMap(PostUpdateTagCommandType, t.config.Hooks.PostUpdateTag, rule)
+}
+
+// rollbackHistoryTo returns history to be recorded after tag moved to the
+// commit: known commits up to the commit are dropped, otherwise current
+// commit of the tag is added
+func rollbackHistoryTo(tag *Tag, history []string, commit string) []string {
+	for i, c := range history {
+		if c == commit {
+			return history[i+1:]
+		}
+	}
+	return append([]string{tag.Commit}, history...)
+}
+
+// findRuleForRollback returns rule by its name, tag or tag with suffix.
+// If nothing found, name is used as a tag name. Rules sharing the tag are
+// reported as ambiguous.
+func (t *Tracker) findRuleForRollback(name string) (*Rule, error) {
+	if rule, ok := t.config.Rules[name]; ok {
+		return t.prepareRuleForRollback(name, rule)
+	}
+	names := make([]string, 0, len(t.config.Rules))
+	for ruleName := range t.config.Rules {
+		names = append(names, ruleName)
+	}
+	sort.Strings(names)
+	var matches []string
+	for _, ruleName := range names {
+		rule := t.config.Rules[ruleName]
+		if rule.Tag == name {
+			matches = append(matches, ruleName)
+			continue
+		}
+		suffix, err := t.GetTagSuffixForRule(rule)
+		if err == nil && rule.Tag+suffix == name {
+			matches = append(matches, ruleName)
+		}
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("tag '%s' matches several rules: %s, specify rule name", name, strings.Join(matches, ", "))
+	}
+	if len(matches) == 1 {
+		return t.prepareRuleForRollback(matches[0], t.config.Rules[matches[0]])
+	}
+	logrus.Warningf("Rule for '%s' not found, it will be used as a tag name.", name)
+	return &Rule{
+		Name:          name,
+		Tag:           name,
+		TagWithSuffix: name,
+	}, nil
+}
+
+func (t *Tracker) prepareRuleForRollback(name string, rule *Rule) (*Rule, error) {
+	suffix, err := t.GetTagSuffixForRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	rule.Name = name
+	rule.TagWithSuffix = rule.Tag + suffix
+	return rule, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTagHistory(t *testing.T) {
+	if history := TagHistory(tagMessage); len(history) != 0 {
+		t.Errorf("Must be empty, but got %v", history)
+	}
+	if message := TagMessageWithHistory(nil); message != tagMessage {
+		t.Errorf("Must be %q, but got %q", tagMessage, message)
+	}
+	history := []string{"222", "111", "000"}
+	message := TagMessageWithHistory(history)
+	if result := TagHistory(message); !reflect.DeepEqual(result, history) {
+		t.Errorf("Must be %v, but got %v", history, result)
+	}
+	history = nil
+	for i := 0; i < tagHistoryLimit+5; i++ {
+		history = append(history, fmt.Sprintf("%03d", i))
+	}
+	result := TagHistory(TagMessageWithHistory(history))
+	if !reflect.DeepEqual(result, history[:tagHistoryLimit]) {
+		t.Errorf("Must be %v, but got %v", history[:tagHistoryLimit], result)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		ref:   "000",
+		config: Config{
+			Hooks: HooksConfig{
+				PostUpdateTag: map[string]*Command{
+					"sync": {
+						Command: []string{"whoami"},
+					},
+				},
+			},
+			Rules: map[string]*Rule{
+				"app": {
+					Tag:       "foobar",
+					TagSuffix: "1.0.0",
+				},
+			},
+		},
+	}
+	if _, _, err := tracker.CreateTagIfNotExists("foobar@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"111", "222"} {
+		tag, err := tracker.forge.GetTag("foobar@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.ref = ref
+		if err := tracker.UpdateTag(tag, true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		to      string
+		steps   int
+		commit  string
+		history []string
+		fail    bool
+	}{
+		{
+			name:  "app",
+			steps: 3,
+			fail:  true,
+		},
+		{
+			name:  "app",
+			steps: 0,
+			fail:  true,
+		},
+		{
+			name:    "foobar",
+			steps:   1,
+			commit:  "111",
+			history: []string{"000"},
+		},
+		{
+			name:    "foobar@1.0.0",
+			to:      "333",
+			commit:  "333",
+			history: []string{"111", "000"},
+		},
+		{
+			name:    "app",
+			to:      "000",
+			commit:  "000",
+			history: []string{},
+		},
+		{
+			name: "app",
+			to:   "000",
+			fail: true,
+		},
+		{
+			name: "not-found",
+			fail: true,
+		},
+	}
+	for i, test := range tests {
+		err := tracker.Rollback(test.name, test.to, test.steps)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%d. Must be an error, but got nil", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. %v", i, err)
+			continue
+		}
+		tag, err := tracker.forge.GetTag("foobar@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag.Commit != test.commit {
+			t.Errorf("%d. Must be %s, but got %s", i, test.commit, tag.Commit)
+		}
+		if history := TagHistory(tag.Message); len(history) != len(test.history) || (len(history) > 0 && !reflect.DeepEqual(history, test.history)) {
+			t.Errorf("%d. Must be %v, but got %v", i, test.history, history)
+		}
+	}
+}
+
+func TestFindRuleForRollback(t *testing.T) {
+	tracker := &Tracker{
+		config: Config{
+			Rules: map[string]*Rule{
+				"app-staging":    {Tag: "app"},
+				"app-production": {Tag: "app"},
+				"web":            {Tag: "web", TagSuffix: "1.0.0"},
+			},
+		},
+	}
+	rule, err := tracker.findRuleForRollback("web@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Name != "web" {
+		t.Errorf("Must be web, but got %s", rule.Name)
+	}
+	rule, err = tracker.findRuleForRollback("app-production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Name != "app-production" {
+		t.Errorf("Must be app-production, but got %s", rule.Name)
+	}
+	if _, err := tracker.findRuleForRollback("app"); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
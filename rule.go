@@ -12,12 +12,24 @@ import (
 )
 
 type Rule struct {
+	Name               string            `yaml:"-" hcl:"-" json:"-"`
 	Path               string            `yaml:"path" hcl:"path" json:"path"`
+	Paths              []string          `yaml:"paths" hcl:"paths" json:"paths"`
+	Exclude            []string          `yaml:"exclude" hcl:"exclude" json:"exclude"`
+	DependsOn          []string          `yaml:"dependsOn" hcl:"depends_on" json:"dependsOn"`
+	Matrix             *RuleMatrix       `yaml:"matrix,omitempty" hcl:"matrix" json:"matrix,omitempty"`
 	Tag                string            `yaml:"tag" hcl:"tag" json:"tag"`
 	TagWithSuffix      string            `yaml:"-" hcl:"-" json:"-"`
 	TagSuffix          string            `yaml:"tagSuffix" hcl:"tag_suffix" json:"tagSuffix"`
 	TagSuffixSeparator string            `yaml:"tagSuffixSeparator" hcl:"tag_suffix_separator" json:"tagSuffixSeparator"`
 	TagSuffixFileRef   *TagSuffixFileRef `yaml:"tagSuffixFileRef" hcl:"tag_suffix_file_ref" json:"tagSuffixFileRef"`
+
+	// Values are values of matrix combination the rule generated for,
+	// available in hooks as {{.Values.Env}}, item is available as {{.Item}}
+	Values map[string]interface{} `yaml:"-" hcl:"-" json:"-"`
+	// Outputs are values captured by commands of the rule, available in
+	// hooks as {{.Outputs.name}}
+	Outputs map[string]string `yaml:"-" hcl:"-" json:"-"`
 }
 
 type TagSuffixFileRef struct {
@@ -27,7 +39,7 @@ type TagSuffixFileRef struct {
 	RegExp    *regexp.Regexp `yaml:"-" hcl:"-" json:"-"`
 }
 
-func (r *Rule) ParseAsTemplate(data map[string]string) error {
+func (r *Rule) ParseAsTemplate(data map[string]interface{}) error {
 	if err := r.parseTmpl(data); err != nil {
 		return err
 	}
@@ -37,9 +49,20 @@ func (r *Rule) ParseAsTemplate(data map[string]string) error {
 	return r.TagSuffixFileRef.parseTmpl(data)
 }
 
+// Item returns item of the matrix the rule generated for, so it's available
+// in hooks as {{.Item.field}} like in options of the rule
+func (r *Rule) Item() MatrixItem {
+	item, _ := r.Values[matrixItemKey].(MatrixItem)
+	return item
+}
+
 func (r *Rule) Clone() *Rule {
 	dest := &Rule{
+		Name:               r.Name,
 		Path:               r.Path,
+		Paths:              append([]string(nil), r.Paths...),
+		Exclude:            append([]string(nil), r.Exclude...),
+		DependsOn:          append([]string(nil), r.DependsOn...),
 		Tag:                r.Tag,
 		TagSuffix:          r.TagSuffix,
 		TagSuffixSeparator: r.TagSuffixSeparator,
@@ -47,27 +70,51 @@ func (r *Rule) Clone() *Rule {
 	if r.TagSuffixFileRef != nil {
 		dest.TagSuffixFileRef = r.TagSuffixFileRef.Clone()
 	}
+	if r.Matrix != nil {
+		dest.Matrix = r.Matrix.Clone()
+	}
+	if r.Values != nil {
+		dest.Values = make(map[string]interface{}, len(r.Values))
+		for k, v := range r.Values {
+			dest.Values[k] = v
+		}
+	}
 	return dest
 }
 
-func (r *Rule) parseTmpl(data map[string]string) error {
+func (r *Rule) parseTmpl(data map[string]interface{}) error {
 	var err error
-	p, err := gotmpl(r.Path, data)
+	p, err := matrixTmpl(r.Path, data)
 	if err != nil {
 		return err
 	}
 	r.Path = p
-	t, err := gotmpl(r.Tag, data)
+	for i, item := range r.Paths {
+		if r.Paths[i], err = matrixTmpl(item, data); err != nil {
+			return err
+		}
+	}
+	for i, item := range r.Exclude {
+		if r.Exclude[i], err = matrixTmpl(item, data); err != nil {
+			return err
+		}
+	}
+	for i, item := range r.DependsOn {
+		if r.DependsOn[i], err = matrixTmpl(item, data); err != nil {
+			return err
+		}
+	}
+	t, err := matrixTmpl(r.Tag, data)
 	if err != nil {
 		return err
 	}
 	r.Tag = t
-	ts, err := gotmpl(r.TagSuffix, data)
+	ts, err := matrixTmpl(r.TagSuffix, data)
 	if err != nil {
 		return err
 	}
 	r.TagSuffix = ts
-	tss, err := gotmpl(r.TagSuffixSeparator, data)
+	tss, err := matrixTmpl(r.TagSuffixSeparator, data)
 	if err != nil {
 		return err
 	}
@@ -75,14 +122,56 @@ func (r *Rule) parseTmpl(data map[string]string) error {
 	return nil
 }
 
+// patterns returns path patterns of the rule in gitignore-style order: the
+// last matching pattern wins, patterns prefixed with ! exclude files
+func (r *Rule) patterns() []string {
+	var patterns []string
+	if len(r.Path) > 0 {
+		patterns = append(patterns, r.Path)
+	}
+	patterns = append(patterns, r.Paths...)
+	for _, pattern := range r.Exclude {
+		patterns = append(patterns, "!"+strings.TrimPrefix(pattern, "!"))
+	}
+	return patterns
+}
+
 func (r *Rule) IsChangesMatch(changes []string) ([]string, bool) {
-	var matches []string
-	gl := glob.MustCompileGlob(r.Path)
+	var (
+		matches  []string
+		excluded []string
+	)
+	patterns := r.patterns()
+	globs := make([]glob.Glob, len(patterns))
+	for i, pattern := range patterns {
+		globs[i] = glob.MustCompileGlob(strings.TrimPrefix(pattern, "!"))
+	}
 	for _, change := range changes {
-		if gl.Match(change) {
+		var match, exclude bool
+		for i, pattern := range patterns {
+			if !strings.HasPrefix(pattern, "!") {
+				if globs[i].Match(change) {
+					match, exclude = true, false
+				}
+				continue
+			}
+			// Exclusion without slash matches file name in any directory
+			if globs[i].Match(change) || !strings.Contains(pattern, "/") && globs[i].Match(path.Base(change)) {
+				if match {
+					exclude = true
+				}
+				match = false
+			}
+		}
+		if match {
 			matches = append(matches, change)
+		} else if exclude {
+			excluded = append(excluded, change)
 		}
 	}
+	if len(matches) > 0 || len(excluded) > 0 {
+		ruleLogger(r).Debugf("Matched files: %v, excluded files: %v.", matches, excluded)
+	}
 	return matches, len(matches) > 0
 }
 
@@ -94,13 +183,13 @@ func (t *TagSuffixFileRef) Clone() *TagSuffixFileRef {
 	}
 }
 
-func (t *TagSuffixFileRef) parseTmpl(data map[string]string) error {
+func (t *TagSuffixFileRef) parseTmpl(data map[string]interface{}) error {
 	var err error
-	t.File, err = gotmpl(t.File, data)
+	t.File, err = matrixTmpl(t.File, data)
 	if err != nil {
 		return err
 	}
-	t.RegExpRaw, err = gotmpl(t.RegExpRaw, data)
+	t.RegExpRaw, err = matrixTmpl(t.RegExpRaw, data)
 	return err
 }
 
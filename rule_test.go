@@ -41,6 +41,51 @@ func TestIsChangesMatch(t *testing.T) {
 	}
 }
 
+func TestIsChangesMatch_Exclude(t *testing.T) {
+	changes := []string{
+		"services/foo/main.go",
+		"services/foo/README.md",
+		"services/foo/docs/index.html",
+		"services/bar/main.go",
+		"libs/common/util.go",
+		"libs/common/vendor/lib.go",
+	}
+	tests := []struct {
+		rule    *Rule
+		matches []string
+	}{
+		{
+			rule: &Rule{
+				Paths:   []string{"services/foo/**", "libs/common/**"},
+				Exclude: []string{"services/foo/docs/**", "*.md"},
+			},
+			matches: []string{"services/foo/main.go", "libs/common/util.go", "libs/common/vendor/lib.go"},
+		},
+		{
+			rule: &Rule{
+				Path:  "libs/**",
+				Paths: []string{"!libs/common/**", "libs/common/vendor/**"},
+			},
+			matches: []string{"libs/common/vendor/lib.go"},
+		},
+		{
+			rule: &Rule{
+				Path:    "services/foo/docs/**",
+				Exclude: []string{"services/**"},
+			},
+		},
+	}
+	for i, test := range tests {
+		matches, match := test.rule.IsChangesMatch(changes)
+		if !reflect.DeepEqual(matches, test.matches) {
+			t.Errorf("%d. Must be %v, but got %v", i, test.matches, matches)
+		}
+		if match != (len(test.matches) > 0) {
+			t.Errorf("%d. Must be %v, but got %v", i, len(test.matches) > 0, match)
+		}
+	}
+}
+
 func TestRule_ParseAsTemplate(t *testing.T) {
 	tests := []struct {
 		r      Rule
@@ -60,6 +105,16 @@ func TestRule_ParseAsTemplate(t *testing.T) {
 				TagSuffixSeparator: "bar",
 			},
 		},
+		{
+			r: Rule{
+				Paths:   []string{"{{ .foo }}/**", "libs/**"},
+				Exclude: []string{"{{ .foo }}/docs/**"},
+			},
+			result: Rule{
+				Paths:   []string{"bar/**", "libs/**"},
+				Exclude: []string{"bar/docs/**"},
+			},
+		},
 		{
 			r: Rule{
 				Path: `{{define "foo"}} FOO `,
@@ -106,7 +161,7 @@ func TestRule_ParseAsTemplate(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		test.r.ParseAsTemplate(map[string]string{
+		test.r.ParseAsTemplate(map[string]interface{}{
 			"foo": "bar",
 		})
 		if !reflect.DeepEqual(test.r, test.result) {
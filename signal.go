@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handleSignals cancels context of the tracker on SIGINT or SIGTERM, so
+// running rules are finished and new ones aren't started, the second
+// signal kills running commands and terminates the process immediately.
+// Returned function stops handling.
+func handleSignals(t *Tracker) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.ctx = ctx
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			logrus.Warningf("Received %s, waiting for running rules to finish. Send it again to exit immediately.", sig)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			logrus.Errorf("Received %s, exit immediately.", sig)
+			// Commands don't receive the signal in their own process groups
+			killRunningCommands()
+			os.Exit(ExitCodeCanceled)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun_Canceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forge := NewFakeForge()
+	tracker := &Tracker{
+		ctx:   ctx,
+		forge: forge,
+		ref:   "000",
+		config: Config{
+			Rules: map[string]*Rule{
+				"foobar": {
+					Path: "foobar/**",
+					Tag:  "foobar",
+				},
+			},
+			Hooks: HooksConfig{
+				PreProcess: map[string]*Command{
+					"prepare": {
+						Command: []string{"true"},
+					},
+				},
+				OnCancel: map[string]*Command{
+					"cleanup": {
+						Command: []string{"touch", path.Join(dir, "canceled")},
+					},
+				},
+			},
+		},
+	}
+	err = tracker.Run(false)
+	if !IsErrCanceled(err) {
+		t.Fatalf("Must be canceled error, but got %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "canceled")); err != nil {
+		t.Errorf("OnCancel hook must be executed: %v", err)
+	}
+	if _, err := forge.GetTag("foobar"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+}
+
+func TestRunCommand_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	cmd := exec.Command("sh", "-c", `trap "echo terminated; exit 3" TERM; echo started; sleep 30 & wait`)
+	buf := bytes.NewBufferString("")
+	err := RunCommand(ctx, cmd, 0, buf, buf)
+	if err == nil || IsErrCommandTimeout(err) {
+		t.Errorf("Must be an exit error, but got %v", err)
+	}
+	if !strings.Contains(buf.String(), "terminated") {
+		t.Errorf("Command must be terminated, but got %q", buf.String())
+	}
+	if elapsed := time.Since(start); elapsed > commandTerminationTimeout {
+		t.Errorf("Must be terminated on cancellation, but took %s", elapsed)
+	}
+}
+
+func TestRun_CanceledDuringHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	forge := NewFakeForge()
+	tracker := &Tracker{
+		ctx:   ctx,
+		forge: forge,
+		ref:   "000",
+		config: Config{
+			Rules: map[string]*Rule{
+				"foobar": {
+					Path: "foobar/**",
+					Tag:  "foobar",
+				},
+			},
+			Hooks: HooksConfig{
+				PreProcess: map[string]*Command{
+					"wait": {
+						Command: []string{"sleep", "30"},
+					},
+				},
+				OnCancel: map[string]*Command{
+					"cleanup": {
+						Command: []string{"touch", path.Join(dir, "canceled")},
+					},
+				},
+			},
+		},
+	}
+	start := time.Now()
+	err = tracker.Run(false)
+	if !IsErrCanceled(err) {
+		t.Fatalf("Must be canceled error, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > commandTerminationTimeout {
+		t.Errorf("Hook must be terminated on cancellation, but took %s", elapsed)
+	}
+	if _, err := os.Stat(path.Join(dir, "canceled")); err != nil {
+		t.Errorf("OnCancel hook must be executed: %v", err)
+	}
+	if _, err := forge.GetTag("foobar"); !IsErrForge(err, TagNotFoundForgeError) {
+		t.Errorf("Must be %s, but got %v", TagNotFoundForgeError, err)
+	}
+}
+
+func TestPrune_Canceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forge := NewFakeForge()
+	if _, err := forge.CreateTag("web", "000", tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		ctx:   ctx,
+		forge: forge,
+		config: Config{
+			Hooks: HooksConfig{
+				OnCancel: map[string]*Command{
+					"cleanup": {
+						Command: []string{"touch", path.Join(dir, "canceled")},
+					},
+				},
+			},
+		},
+	}
+	if err := tracker.Prune(); !IsErrCanceled(err) {
+		t.Fatalf("Must be canceled error, but got %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "canceled")); err != nil {
+		t.Errorf("OnCancel hook must be executed: %v", err)
+	}
+}
+
+func TestKillRunningCommands(t *testing.T) {
+	done := make(chan error, 1)
+	go func() {
+		// Command ignores termination, so it's stopped by kill only
+		cmd := exec.Command("sh", "-c", `trap "" TERM; sleep 30 & wait`)
+		done <- RunCommand(context.Background(), cmd, 0, ioutil.Discard, ioutil.Discard)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	killRunningCommands()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Must be an error, but got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Command must be killed")
+	}
+}
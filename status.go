@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	TagMissingStatus  = "missing"
+	TagUpToDateStatus = "up-to-date"
+	TagOutdatedStatus = "outdated"
+	TagUnknownStatus  = "unknown"
+)
+
+// RuleStatus describes state of the rule tag compared with current commit
+type RuleStatus struct {
+	Rule    string   `json:"rule"`
+	Tag     string   `json:"tag"`
+	Commit  string   `json:"commit,omitempty"`
+	Status  string   `json:"status"`
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Status returns state of every rule tag ordered by rule name
+func (t *Tracker) Status() []*RuleStatus {
+	names := make([]string, 0, len(t.config.Rules))
+	for name := range t.config.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result []*RuleStatus
+	for _, name := range names {
+		result = append(result, t.ruleStatus(name, t.config.Rules[name]))
+	}
+	return result
+}
+
+func (t *Tracker) ruleStatus(name string, rule *Rule) *RuleStatus {
+	status := &RuleStatus{
+		Rule:   name,
+		Tag:    rule.Tag,
+		Status: TagUnknownStatus,
+	}
+	suffix, err := t.GetTagSuffixForRule(rule)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Tag = rule.Tag + suffix
+	tag, err := t.forge.GetTag(status.Tag)
+	if IsErrForge(err, TagNotFoundForgeError) {
+		status.Status = TagMissingStatus
+		return status
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Commit = tag.Commit
+	status.Status = TagUpToDateStatus
+	if tag.Commit == t.ref {
+		return status
+	}
+	changes, err := t.diffWithFetch(tag.Commit, t.ref)
+	if err != nil {
+		status.Status = TagUnknownStatus
+		status.Error = err.Error()
+		return status
+	}
+	if matches, _, ok := t.matchChanges(rule, changes); ok {
+		status.Status = TagOutdatedStatus
+		status.Changes = matches
+	}
+	return status
+}
+
+// PrintStatus writes statuses as a table
+func PrintStatus(w io.Writer, statuses []*RuleStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tTAG\tCOMMIT\tSTATUS\tCHANGES")
+	for _, s := range statuses {
+		commit := s.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		details := strings.Join(s.Changes, ", ")
+		if len(s.Error) > 0 {
+			details = s.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Rule, s.Tag, commit, s.Status, details)
+	}
+	return tw.Flush()
+}
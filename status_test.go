@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
+		config: Config{
+			Rules: map[string]*Rule{
+				"changed": {
+					Path: "test_file",
+					Tag:  "changed",
+				},
+				"missing": {
+					Path: "test_file",
+					Tag:  "missing",
+				},
+				"same": {
+					Path: "other_file",
+					Tag:  "same",
+				},
+				"suffix": {
+					Tag: "suffix",
+					TagSuffixFileRef: &TagSuffixFileRef{
+						File: "not-found",
+					},
+				},
+			},
+		},
+	}
+	for _, name := range []string{"changed", "same"} {
+		if _, _, err := tracker.CreateTagIfNotExists(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(repoDir, "test_file"), []byte(`image: foobar:2.0.0`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.ref, err = le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := tracker.Status()
+	expected := []struct {
+		rule   string
+		status string
+	}{
+		{"changed", TagOutdatedStatus},
+		{"missing", TagMissingStatus},
+		{"same", TagUpToDateStatus},
+		{"suffix", TagUnknownStatus},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Must be %d, but got %d", len(expected), len(statuses))
+	}
+	for i, e := range expected {
+		if statuses[i].Rule != e.rule || statuses[i].Status != e.status {
+			t.Errorf("%d. Must be %s %s, but got %s %s", i, e.rule, e.status, statuses[i].Rule, statuses[i].Status)
+		}
+	}
+	if len(statuses[0].Changes) != 1 || statuses[0].Changes[0] != "test_file" {
+		t.Errorf("Must be [test_file], but got %v", statuses[0].Changes)
+	}
+	if statuses[0].Commit != commit {
+		t.Errorf("Must be %s, but got %s", commit, statuses[0].Commit)
+	}
+	if len(statuses[3].Error) == 0 {
+		t.Error("Must be an error, but got nothing")
+	}
+	buf := bytes.NewBufferString("")
+	if err := PrintStatus(buf, statuses); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected)+1 {
+		t.Errorf("Must be %d lines, but got %q", len(expected)+1, buf.String())
+	}
+	if !strings.Contains(lines[1], commit[:8]) || strings.Contains(lines[1], commit) {
+		t.Errorf("Line must contain short commit, but got %q", lines[1])
+	}
+}
@@ -0,0 +1,22 @@
+rules "app" {
+    path = "services/{{.Item}}/**"
+    tag = "{{.Item.namespace}}-{{.Item}}"
+    tag_suffix_file_ref {
+        file = "services/{{.Item}}/deployment.yaml"
+        regexp = "{{.Item.registry}}/{{.Item}}:(.*)$"
+    }
+    matrix {
+        items = [
+            {
+                name = "billing"
+                namespace = "payments"
+                registry = "eu.gcr.io/x"
+            },
+            {
+                name = "web"
+                namespace = "frontend"
+                registry = "eu.gcr.io/y"
+            },
+        ]
+    }
+}
@@ -0,0 +1,11 @@
+rules "foo" {
+    tag = "foo"
+    paths = [
+        "services/foo/**",
+        "libs/common/**",
+    ]
+    exclude = [
+        "services/foo/docs/**",
+        "*.md",
+    ]
+}
@@ -0,0 +1,27 @@
+rules "app" {
+    path = "services/{{.Item}}/**"
+    tag = "{{.Item}}-{{.Env}}"
+    matrix {
+        items = ["foo", "bar"]
+        dimensions {
+            Env = ["staging", "production"]
+        }
+        exclude = [
+            {
+                Item = "bar"
+                Env = "staging"
+            },
+        ]
+        include = [
+            {
+                Item = "baz"
+                Env = "production"
+            },
+        ]
+    }
+}
+
+rules "lib" {
+    path = "libs/**"
+    tag = "lib"
+}
@@ -3,21 +3,22 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/hcl"
 	"github.com/sirupsen/logrus"
-	"github.com/xanzy/go-gitlab"
 	"gopkg.in/yaml.v2"
 )
 
@@ -25,7 +26,6 @@ type CommandType string
 
 const (
 	tagMessage          = "Auto-generated. Do not Remove."
-	errTagNotFound      = "Tag Not Found"
 	descriptionTemplate = "<details><summary>Details</summary><pre><code>%s</code></pre></details>"
 
 	defaultTagSuffixSeparator = "@"
@@ -34,8 +34,10 @@ const (
 	PreProcessCommandType    CommandType = "PreProcess"
 	PostCreateTagCommandType CommandType = "PostCreateTag"
 	PostUpdateTagCommandType CommandType = "PostUpdateTag"
+	PostDeleteTagCommandType CommandType = "PostDeleteTag"
 	PostProcessCommandType   CommandType = "PostProcess"
 	PostFlightCommandType    CommandType = "PostFlight"
+	OnCancelCommandType      CommandType = "OnCancel"
 )
 
 var (
@@ -44,48 +46,99 @@ var (
 		Transport: RetryTransport(),
 	}
 	tagSuffixReplacer = strings.NewReplacer("/", "", ":", "-")
+	// tagRetryConfig used to create tag again after it was deleted
+	tagRetryConfig = RetryConfig{
+		Maximum:  3,
+		Interval: time.Second,
+	}
 )
 
 type Tracker struct {
-	dir         string
-	git         string
-	gitLabToken string
-	gitLabURL   string
-	beforeRef   string
-	ref         string
-	proj        string
-	gitLab      gitlabClient
-	config      Config
-}
-
-func NewTracker(workDir string) (*Tracker, error) {
-	g, err := exec.LookPath("git")
-	if err != nil {
-		return nil, err
-	}
+	dir       string
+	git       string
+	apiToken  string
+	apiURL    string
+	beforeRef string
+	ref       string
+	proj      string
+	forge     Forge
+	config    Config
+	plan      *Plan
+	// matrixSources are items of matrix sources the rules expanded with
+	matrixSources []MatrixSource
+	// skipMatrixCommands leaves matrix items of commands unexpanded, so
+	// configuration is loaded without running anything
+	skipMatrixCommands bool
+	// overrides are values of the environment specified explicitly
+	overrides Environment
+	// fetchMu serializes fetches of missing commits by rules
+	fetchMu sync.Mutex
+	// fetchedCommits are results of ensureCommit by sha, so every missing
+	// commit is fetched once for all the rules
+	fetchedCommits map[string]error
+	// ctx is canceled by termination signal, new rules and commands aren't
+	// started after that
+	ctx context.Context
+}
+
+// LoadTracker returns Tracker with loaded configuration only, it can't
+// be used to make requests to GitLab. Config file will be discovered in
+// workDir if filename is empty. Matrix items of commands aren't loaded.
+func LoadTracker(workDir, filename string) (*Tracker, error) {
+	return loadTracker(workDir, filename, true)
+}
+
+func loadTracker(workDir, filename string, skipMatrixCommands bool) (*Tracker, error) {
 	t := &Tracker{
-		git: g,
-		dir: workDir,
+		dir:                workDir,
+		skipMatrixCommands: skipMatrixCommands,
+	}
+	if len(filename) == 0 {
+		f, err := DiscoverConfigFile(t.dir)
+		if err != nil {
+			return nil, err
+		}
+		filename = f
 	}
-	filename, err := DiscoverConfigFile(t.dir)
+	err := t.LoadRules(filename)
 	if err != nil {
 		return nil, err
 	}
-	err = t.LoadRules(filename)
+	return t, nil
+}
+
+// NewTracker returns Tracker with loaded configuration and environment,
+// non-empty fields of env override ones detected from CI system
+func NewTracker(workDir, filename string, env Environment) (*Tracker, error) {
+	t, err := loadTracker(workDir, filename, false)
 	if err != nil {
 		return nil, err
 	}
-	err = t.LoadEnvironment()
-	if err != nil {
+	// Git isn't required if changes are found with API
+	g, err := exec.LookPath("git")
+	if err != nil && t.config.diffSource() != DiffSourceAPI {
 		return nil, err
 	}
-
-	cli := gitlab.NewClient(httpCli, t.gitLabToken)
-	err = cli.SetBaseURL(t.gitLabURL)
+	t.git = g
+	t.overrides = env
+	err = t.LoadEnvironment()
 	if err != nil {
 		return nil, err
 	}
-	t.gitLab = gitlabRealClient(*cli)
+	if t.config.provider() == GitForge {
+		t.forge = &gitForge{
+			git:    t.gitCommand,
+			remote: t.config.gitRemote(),
+		}
+	} else {
+		t.forge, err = NewForge(t.config.provider(), t.apiURL, t.apiToken, t.proj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := t.forge.(Comparer); !ok && t.config.diffSource() == DiffSourceAPI {
+		return nil, fmt.Errorf("provider %s doesn't support %q diff source", t.config.provider(), DiffSourceAPI)
+	}
 	return t, nil
 }
 
@@ -120,6 +173,8 @@ func (t *Tracker) ProcessRule(rule *Rule, force bool) error {
 	if len(suffix) > 0 {
 		rule.TagWithSuffix = rule.Tag + suffix
 	}
+	// Outputs of the previous run or plan must not be used by hooks
+	rule.Outputs = map[string]string{}
 	err = t.ExecCommandMap(PreProcessCommandType, t.config.Hooks.PreProcess, rule)
 	if err != nil {
 		return err
@@ -133,45 +188,220 @@ func (t *Tracker) ProcessRule(rule *Rule, force bool) error {
 
 func (t *Tracker) processRule(rule *Rule, force bool) error {
 	var (
-		matches []string
-		match   bool
+		matches  []string
+		triggers []string
+		match    bool
 	)
-	exists, tag, err := t.CreateTagIfNotExists(rule.TagWithSuffix)
+	if t.canceled() {
+		return ErrCanceled{}
+	}
+	exists, tag, err := t.createTagIfNotExists(rule, rule.TagWithSuffix)
 	if err != nil {
 		return err
 	}
 	if !exists {
 		return t.ExecCommandMap(PostCreateTagCommandType, t.config.Hooks.PostCreateTag, rule)
 	}
-	destRef := rule.TagWithSuffix
-	if len(t.beforeRef) > 0 {
-		// Try to use CI_COMMIT_BEFORE_SHA
-		destRef = t.beforeRef
+	destRef, err := t.diffBase(rule, tag)
+	if err != nil {
+		return err
 	}
 	changesHead, err := t.Diff(t.ref, destRef)
 	if err != nil {
 		return err
 	}
-	if t.ref != tag.Commit.ID {
-		changesTag, err := t.Diff(t.ref, tag.Commit.ID)
-		if err == nil {
-			matches, match = rule.IsChangesMatch(changesTag)
+	if t.ref != tag.Commit {
+		changesTag, err := t.diffWithFetch(t.ref, tag.Commit)
+		if err != nil {
+			ruleLogger(rule).Warningf("Failed to compare with '%s' tag commit, only changes since %s are checked: %v", tag.Name, destRef, err)
+		} else {
+			matches, triggers, match = t.matchChanges(rule, changesTag)
 		}
 	}
-	matchesHead, matchHead := rule.IsChangesMatch(changesHead)
+	matchesHead, triggersHead, matchHead := t.matchChanges(rule, changesHead)
 	if matchHead {
 		match = true
 		matches = matchesHead
+		triggers = triggersHead
 	}
 	if !match {
-		logrus.Debug("Nothing changed.")
+		ruleLogger(rule).Debug("Nothing changed.")
 		return nil
 	}
-	err = t.UpdateTag(tag, true, matches)
+	if t.ref != tag.Commit {
+		// Tag can't be moved safely if it's unknown whether it's moved backwards
+		isAncestor, err := t.IsAncestor(tag.Commit, t.ref)
+		if err != nil {
+			err = fmt.Errorf("failed to check that %s is a descendant of '%s' tag commit: %v", t.ref, tag.Name, err)
+			// Errors of API aren't related to the clone, e.g. access denied
+			if t.config.diffSource() == DiffSourceAPI {
+				return err
+			}
+		} else if !isAncestor {
+			err = fmt.Errorf("%s is not a descendant of '%s' tag commit %s, tag can't be moved backwards", t.ref, tag.Name, tag.Commit)
+		}
+		if err != nil {
+			if t.config.OnStaleRef == StaleRefFail {
+				return err
+			}
+			ruleLogger(rule).Warningf("Skipped: %v", err)
+			return nil
+		}
+	}
+	// Tag move started before cancellation is finished or rolled back
+	if t.canceled() {
+		return ErrCanceled{}
+	}
+	err = t.updateTag(rule, tag, true, matches)
 	if err != nil {
 		return err
 	}
-	return t.ExecCommandMap(PostUpdateTagCommandType, t.config.Hooks.PostUpdateTag, rule)
+	// Release is created after hooks to list outputs captured by them, it's
+	// created even if hooks failed as the tag is moved already
+	hooksErr := t.ExecCommandMap(PostUpdateTagCommandType, t.config.Hooks.PostUpdateTag, rule)
+	if err := t.createRelease(rule, tag, matches, triggers); err != nil {
+		return err
+	}
+	return hooksErr
+}
+
+// diffBase returns commit to find changes since. Previous commit of the
+// branch is used if it's known and exists in the clone, otherwise tag commit
+// or merge-base with default branch.
+func (t *Tracker) diffBase(rule *Rule, tag *Tag) (string, error) {
+	var reason string
+	switch {
+	case len(t.beforeRef) == 0:
+		reason = "previous commit is not specified"
+	case isZeroCommit(t.beforeRef):
+		reason = "previous commit is zero, branch is new"
+	case t.ensureCommit(t.beforeRef) != nil:
+		reason = fmt.Sprintf("previous commit %s not found in the clone, branch was force-pushed", t.beforeRef)
+	default:
+		ruleLogger(rule).Debugf("Diff base is previous commit %s.", t.beforeRef)
+		return t.beforeRef, nil
+	}
+	if t.ensureCommit(tag.Commit) == nil {
+		ruleLogger(rule).Infof("Diff base is '%s' tag commit %s: %s.", tag.Name, tag.Commit, reason)
+		return tag.Commit, nil
+	}
+	reason = fmt.Sprintf("%s, '%s' tag commit %s not found in the clone", reason, tag.Name, tag.Commit)
+	branch, err := t.defaultBranch()
+	if err != nil {
+		return "", fmt.Errorf("failed to choose diff base, %s: %v", reason, err)
+	}
+	base, err := t.mergeBase(t.ref, branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to choose diff base, %s: merge-base with %s: %v", reason, branch, err)
+	}
+	ruleLogger(rule).Infof("Diff base is merge-base %s with %s: %s.", base, branch, reason)
+	return base, nil
+}
+
+// isZeroCommit reports whether sha is a zero one, e.g. CI_COMMIT_BEFORE_SHA
+// of the first push to branch
+func isZeroCommit(sha string) bool {
+	return len(strings.Trim(sha, "0")) == 0
+}
+
+// commitExists reports whether commit is available in the clone
+func (t *Tracker) commitExists(sha string) bool {
+	return t.gitCommand("cat-file", "-e", sha+"^{commit}").Run() == nil
+}
+
+// ensureCommit fetches commit if it's missing in the clone: directly by
+// sha first, then by deepening shallow clone up to configured limit
+func (t *Tracker) ensureCommit(sha string) error {
+	// Commits are available to API without clone
+	if t.config.diffSource() == DiffSourceAPI || t.commitExists(sha) {
+		return nil
+	}
+	limit := t.config.fetchDepthLimit()
+	if limit < 0 {
+		return fmt.Errorf("commit %s not found in the clone", sha)
+	}
+	t.fetchMu.Lock()
+	defer t.fetchMu.Unlock()
+	// Commit could be fetched by another rule
+	if t.commitExists(sha) {
+		return nil
+	}
+	if err, ok := t.fetchedCommits[sha]; ok {
+		return err
+	}
+	err := t.fetchCommit(sha, limit)
+	if t.fetchedCommits == nil {
+		t.fetchedCommits = make(map[string]error)
+	}
+	t.fetchedCommits[sha] = err
+	return err
+}
+
+// fetchCommit fetches missing commit by sha or by deepening the clone
+// while it's shallow
+func (t *Tracker) fetchCommit(sha string, limit int) error {
+	remote := t.config.gitRemote()
+	logrus.Debugf("Fetch missing commit %s from %s.", sha, remote)
+	output, err := t.gitCommand("fetch", "--no-tags", remote, sha).CombinedOutput()
+	if err == nil && t.commitExists(sha) {
+		return nil
+	}
+	if err != nil {
+		logrus.Debugf("Failed to fetch %s: %v: %s", sha, err, strings.TrimSpace(string(output)))
+	}
+	for depth := 0; depth < limit; depth += fetchDepthStep {
+		// Full clone can't be deepened
+		if !t.isShallow() {
+			break
+		}
+		logrus.Debugf("Deepen clone by %d commits to find %s.", fetchDepthStep, sha)
+		output, err := t.gitCommand("fetch", "--no-tags", fmt.Sprintf("--deepen=%d", fetchDepthStep), remote).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to deepen clone: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		if t.commitExists(sha) {
+			return nil
+		}
+	}
+	return fmt.Errorf("commit %s not found in the clone deepened by up to %d commits", sha, limit)
+}
+
+// isShallow reports whether the clone is shallow
+func (t *Tracker) isShallow() bool {
+	output, err := t.gitCommand("rev-parse", "--is-shallow-repository").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// diffWithFetch returns changes between commits, fetching missing ones
+func (t *Tracker) diffWithFetch(head, sha string) ([]string, error) {
+	for _, commit := range []string{head, sha} {
+		if err := t.ensureCommit(commit); err != nil {
+			return nil, err
+		}
+	}
+	return t.Diff(head, sha)
+}
+
+// defaultBranch returns remote-tracking branch of the default branch,
+// CI_DEFAULT_BRANCH is used if specified. Branch itself is returned if
+// changes are found with API.
+func (t *Tracker) defaultBranch() (string, error) {
+	remote := t.config.gitRemote()
+	branch := os.Getenv("CI_DEFAULT_BRANCH")
+	if t.config.diffSource() == DiffSourceAPI {
+		if len(branch) == 0 {
+			return "", fmt.Errorf("default branch is unknown, CI_DEFAULT_BRANCH must be specified")
+		}
+		return branch, nil
+	}
+	if len(branch) > 0 {
+		return remote + "/" + branch, nil
+	}
+	output, err := t.gitCommand("symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get default branch of %s: %v: %s", remote, err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
 }
 
 func (t *Tracker) RunChecksPreFlight() error {
@@ -199,6 +429,26 @@ func (t *Tracker) RunChecksPostFlight() error {
 }
 
 func (t *Tracker) Run(force bool) error {
+	return t.handleCancel(t.run(force))
+}
+
+// handleCancel runs OnCancel hooks if processing was canceled and returns
+// ErrCanceled then
+func (t *Tracker) handleCancel(err error) error {
+	if !t.canceled() {
+		return err
+	}
+	logrus.Warning("Processing canceled.")
+	if cancelErr := t.ExecCommandMap(OnCancelCommandType, t.config.Hooks.OnCancel, nil); cancelErr != nil {
+		logrus.Error(cancelErr)
+	}
+	if IsErrCanceled(err) {
+		return err
+	}
+	return ErrCanceled{Err: err}
+}
+
+func (t *Tracker) run(force bool) error {
 	if err := t.RunChecksPreFlight(); err != nil {
 		return err
 	}
@@ -209,114 +459,395 @@ func (t *Tracker) Run(force bool) error {
 	return t.RunChecksPostFlight()
 }
 
+// context returns context canceled by termination signal
+func (t *Tracker) context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+func (t *Tracker) canceled() bool {
+	return t.context().Err() != nil
+}
+
+// BuildPlan walks rules the same way as Run does, but collects actions
+// that change GitLab state or run commands instead of executing them
+func (t *Tracker) BuildPlan(force bool) (*Plan, error) {
+	t.plan = &Plan{}
+	defer func() {
+		t.plan = nil
+	}()
+	plan := t.plan
+	err := t.Run(force)
+	plan.Sort()
+	return plan, err
+}
+
 func (t *Tracker) UpdateTags(force bool) error {
-	var failed bool
-	for _, rule := range t.config.Rules {
-		err := t.ProcessRule(rule, force)
-		if err == nil {
-			continue
+	var (
+		failed = make(map[string]error)
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	names := make([]string, 0, len(t.config.Rules))
+	for name, rule := range t.config.Rules {
+		if len(rule.Name) == 0 {
+			rule.Name = name
 		}
-		// Одна из команда может вернуть ошибку, которую пользователь
-		// попросил игнорировать через SkipOnFailure, в таком случае
-		// не фиксируем неудачу, продолжив обработку остальные правила
-		if IsIgnorableErrFailedCommandExecution(err) {
-			logrus.Debug(err)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	queue := make(chan *Rule)
+	for i := 0; i < t.concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rule := range queue {
+				err := t.ProcessRule(rule, force)
+				if err == nil {
+					continue
+				}
+				// Одна из команда может вернуть ошибку, которую пользователь
+				// попросил игнорировать через SkipOnFailure, в таком случае
+				// не фиксируем неудачу, продолжив обработку остальные правила
+				if IsIgnorableErrFailedCommandExecution(err) {
+					ruleLogger(rule).Debug(err)
+					continue
+				}
+				if IsErrCanceled(err) {
+					t.logRuleError(rule, err)
+					continue
+				}
+				mu.Lock()
+				failed[rule.Name] = err
+				mu.Unlock()
+				t.logRuleError(rule, err)
+			}
+		}()
+	}
+	skipped := 0
+	for i, name := range names {
+		select {
+		case queue <- t.config.Rules[name]:
 			continue
+		case <-t.context().Done():
+			skipped = len(names) - i
 		}
-		failed = true
-		logrus.Error(err)
+		break
+	}
+	close(queue)
+	wg.Wait()
+	if skipped > 0 {
+		logrus.Warningf("Skipped %d rule(s) on cancellation.", skipped)
 	}
-	if failed {
-		return errors.New("failed")
+	if len(failed) > 0 {
+		return ErrRulesFailed{Errors: failed}
+	}
+	if t.canceled() {
+		return ErrCanceled{}
 	}
 	return nil
 }
 
+// logRuleError logs error of the rule with a hint for known forge errors
+func (t *Tracker) logRuleError(rule *Rule, err error) {
+	logger := ruleLogger(rule)
+	switch {
+	case IsErrCanceled(err):
+		logger.Warningf("Stopped: %v", err)
+	case IsErrForge(err, ForbiddenForgeError):
+		logger.Errorf("Access denied, check permissions of the token: %v", err)
+	case IsErrForge(err, ProjectNotFoundForgeError):
+		logger.Errorf("Project %s not found, check its path and token access: %v", t.proj, err)
+	case IsErrForge(err, RateLimitedForgeError):
+		logger.Errorf("API rate limit exceeded, try again later: %v", err)
+	default:
+		logger.Error(err)
+	}
+}
+
+func (t *Tracker) concurrency() int {
+	concurrency := GetIntEnv("GT_CONCURRENCY", t.config.Concurrency)
+	if concurrency < 1 {
+		return 1
+	}
+	return concurrency
+}
+
+func ruleLogger(rule *Rule) *logrus.Entry {
+	if rule == nil || len(rule.Name) == 0 {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return logrus.WithField("rule", rule.Name)
+}
+
 func (t *Tracker) ExecCommandMap(commandType CommandType, commands map[string]*Command, rule *Rule) error {
-	for name, command := range commands {
+	order, err := commandOrder(commands)
+	if err != nil {
+		return err
+	}
+	if len(order) > 1 {
+		ruleLogger(rule).Debugf("Order of %s commands: %s.", commandType, strings.Join(order, ", "))
+	}
+	// Commands of OnCancel type are run after cancellation
+	ctx := t.context()
+	if commandType == OnCancelCommandType {
+		ctx = context.Background()
+	}
+	for _, name := range order {
+		command := commands[name]
 		if command == nil || len(command.Command) == 0 {
 			continue
 		}
+		if t.plan != nil {
+			if err := t.planCommand(commandType, name, command, rule); err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return ErrCanceled{}
+		}
 		if command.InitialDelaySeconds > 0 {
-			time.Sleep(time.Duration(command.InitialDelaySeconds) * time.Second)
+			select {
+			case <-time.After(time.Duration(command.InitialDelaySeconds) * time.Second):
+			case <-ctx.Done():
+				return ErrCanceled{}
+			}
 		}
 		err := Retry(func(s *Stats) error {
-			logrus.Debugf("Exec %v as %s command (%s).", command.Command, commandType, s)
+			ruleLogger(rule).Debugf("Exec %v as %s command (%s).", command.Command, commandType, s)
 			cmd, err := ProcessCommand(rule, command.Command)
 			if err != nil {
 				return err
 			}
-			b, err := cmd.CombinedOutput()
+			output := t.commandOutput(commandType, name, rule)
+			// Only stdout is captured
+			var capture io.Writer
+			captured := bytes.NewBufferString("")
+			if command.Capture != nil {
+				capture = captured
+			}
+			err = RunCommand(ctx, cmd, t.config.commandTimeout(command), output.Stream(capture), output.Stream(nil))
+			if closeErr := output.Close(); closeErr != nil {
+				ruleLogger(rule).Warningf("Failed to write log of %s command %s: %v", commandType, name, closeErr)
+			}
+			if ctx.Err() != nil {
+				s.Break()
+				return ErrCanceled{Err: err}
+			}
+			if e, ok := err.(ErrCommandTimeout); ok {
+				e.Output = output.Tail()
+				return e
+			}
 			if err != nil {
-				return fmt.Errorf("%v: %s", err, string(b))
+				return fmt.Errorf("%v: %s", err, output.Tail())
+			}
+			if command.Capture != nil && rule != nil {
+				value, err := command.Capture.Value(captured.String())
+				if err != nil {
+					return fmt.Errorf("failed to capture %s: %v", command.Capture.Name, err)
+				}
+				if rule.Outputs == nil {
+					rule.Outputs = make(map[string]string)
+				}
+				rule.Outputs[command.Capture.Name] = value
 			}
-			logrus.Debugf("Command %v output: %s", command.Command, string(b))
 			return nil
 		}, command.RetryConfig)
+		if IsErrCanceled(err) {
+			return err
+		}
 		if !command.AllowFailure && err != nil {
 			return ErrFailedCommandExecution{
 				Ignore:      command.SkipOnFailure,
 				CommandType: commandType,
 				Name:        name,
 				Message:     err.Error(),
+				Timeout:     IsErrCommandTimeout(err),
 			}
 		}
 	}
 	return nil
 }
 
-func (t *Tracker) CreateTagIfNotExists(tagName string) (bool, *gitlab.Tag, error) {
-	tag, _, err := t.gitLab.GetTag(t.proj, tagName, nil)
-	if err != nil && !strings.Contains(err.Error(), errTagNotFound) {
-		return false, nil, err
+func (t *Tracker) planCommand(commandType CommandType, name string, command *Command, rule *Rule) error {
+	cmd, err := ProcessCommand(rule, command.Command)
+	if err != nil {
+		return ErrFailedCommandExecution{
+			Ignore:      command.SkipOnFailure,
+			CommandType: commandType,
+			Name:        name,
+			Message:     err.Error(),
+		}
 	}
-	if tag != nil {
+	t.plan.Add(&PlanAction{
+		Type:        RunCommandPlanAction,
+		Rule:        planRuleName(rule),
+		CommandType: commandType,
+		Name:        name,
+		Command:     cmd.Args,
+	})
+	// Commands aren't run, so placeholder is rendered instead of output
+	if command.Capture != nil && rule != nil {
+		if rule.Outputs == nil {
+			rule.Outputs = make(map[string]string)
+		}
+		rule.Outputs[command.Capture.Name] = fmt.Sprintf("<output of %s>", name)
+	}
+	return nil
+}
+
+func (t *Tracker) CreateTagIfNotExists(tagName string) (bool, *Tag, error) {
+	return t.createTagIfNotExists(nil, tagName)
+}
+
+// planRuleName returns name of the rule for plan actions
+func planRuleName(rule *Rule) string {
+	if rule == nil {
+		return ""
+	}
+	return rule.Name
+}
+
+func (t *Tracker) createTagIfNotExists(rule *Rule, tagName string) (bool, *Tag, error) {
+	tag, err := t.forge.GetTag(tagName)
+	if err == nil {
 		return true, tag, nil
 	}
+	if !IsErrForge(err, TagNotFoundForgeError) {
+		return false, nil, err
+	}
+	if t.plan != nil {
+		t.plan.Add(&PlanAction{
+			Type: CreateTagPlanAction,
+			Rule: planRuleName(rule),
+			Tag:  tagName,
+			Ref:  t.ref,
+		})
+		return false, nil, nil
+	}
 	logrus.Infof("Create '%s' tag.", tagName)
 	tag, err = t.CreateTagForRef(tagName, t.ref)
+	if IsErrForge(err, ConflictForgeError) {
+		// Tag was created by concurrent pipeline
+		logrus.Warningf("Tag '%s' was created concurrently, use existing one.", tagName)
+		tag, err = t.forge.GetTag(tagName)
+		if err != nil {
+			return false, nil, err
+		}
+		return true, tag, nil
+	}
 	return false, tag, err
 }
 
-func (t *Tracker) CreateTagForRef(tagName, ref string) (*gitlab.Tag, error) {
+func (t *Tracker) CreateTagForRef(tagName, ref string) (*Tag, error) {
+	return t.createTag(tagName, ref, tagMessage)
+}
+
+func (t *Tracker) createTag(tagName, ref, message string) (*Tag, error) {
 	logrus.Infof("Create '%s' tag with %s ref.", tagName, ref)
-	opts := &gitlab.CreateTagOptions{
-		TagName: gitlab.String(tagName),
-		Ref:     gitlab.String(ref),
-		Message: gitlab.String(tagMessage),
-	}
-	tag, _, err := t.gitLab.CreateTag(t.proj, opts, nil)
-	return tag, err
+	return t.forge.CreateTag(tagName, ref, message)
 }
 
-func (t *Tracker) UpdateTag(tag *gitlab.Tag, force bool, changes []string) error {
+// moveTag recreates tag at ref with message. If tag was deleted, but can't
+// be created again, it will be restored at previous commit with previous
+// message.
+func (t *Tracker) moveTag(tag *Tag, ref, message string, force bool) error {
 	if force {
-		_, err := t.gitLab.DeleteTag(t.proj, tag.Name, nil)
-		if err != nil && !strings.Contains(err.Error(), errTagNotFound) {
+		err := t.forge.DeleteTag(tag.Name)
+		if IsErrForge(err, TagNotFoundForgeError) {
+			logrus.Warningf("Tag '%s' already deleted.", tag.Name)
+		} else if err != nil {
 			return err
 		}
 	}
-	_, err := t.CreateTagForRef(tag.Name, t.ref)
-	if err != nil {
+	config := tagRetryConfig
+	err := Retry(func(s *Stats) error {
+		_, err := t.createTag(tag.Name, ref, message)
+		if err != nil {
+			logrus.Warningf("Failed to create '%s' tag (%s): %v", tag.Name, s, err)
+		}
 		return err
+	}, &config)
+	if err == nil || !force {
+		return err
+	}
+	prevMessage := tag.Message
+	if len(prevMessage) == 0 {
+		prevMessage = tagMessage
+	}
+	logrus.Warningf("Restore '%s' tag at %s.", tag.Name, tag.Commit)
+	_, restoreErr := t.createTag(tag.Name, tag.Commit, prevMessage)
+	if restoreErr != nil {
+		return fmt.Errorf("failed to move '%s' tag to %s: %v; failed to restore it at %s: %v", tag.Name, ref, err, tag.Commit, restoreErr)
+	}
+	return ErrTagMoveRolledBack{
+		Tag:  tag.Name,
+		From: tag.Commit,
+		To:   ref,
+		Err:  err,
+	}
+}
+
+func (t *Tracker) UpdateTag(tag *Tag, force bool, changes []string) error {
+	if err := t.updateTag(nil, tag, force, changes); err != nil {
+		return err
+	}
+	return t.createRelease(nil, tag, changes, nil)
+}
+
+// updateTag moves tag of the rule to the ref recording its current commit
+// in history
+func (t *Tracker) updateTag(rule *Rule, tag *Tag, force bool, changes []string) error {
+	if t.plan != nil {
+		t.plan.Add(&PlanAction{
+			Type:    MoveTagPlanAction,
+			Rule:    planRuleName(rule),
+			Tag:     tag.Name,
+			From:    tag.Commit,
+			Ref:     t.ref,
+			Changes: changes,
+		})
+		return nil
+	}
+	history := TagHistory(tag.Message)
+	if tag.Commit != t.ref {
+		history = append([]string{tag.Commit}, history...)
+	}
+	return t.moveTag(tag, t.ref, TagMessageWithHistory(history), force)
+}
+
+// createRelease creates release of the tag moved from its commit to the
+// ref with changes, triggers are dependencies of the rule changed, values
+// captured by hooks of the rule are listed too
+func (t *Tracker) createRelease(rule *Rule, tag *Tag, changes, triggers []string) error {
+	var outputs map[string]string
+	if rule != nil {
+		outputs = rule.Outputs
 	}
 	if changes == nil {
 		return nil
 	}
-	stat, err := t.DiffStat(tag.Commit.ID, t.ref, changes)
+	stat, err := t.DiffStat(tag.Commit, t.ref, changes)
 	if err != nil {
 		return err
 	}
 	if len(stat) == 0 {
 		return nil
 	}
-	message := fmt.Sprintf(descriptionTemplate, stat)
-	opts := &gitlab.CreateReleaseOptions{
-		Name:        gitlab.String(tag.Name),
-		TagName:     gitlab.String(tag.Name),
-		Description: gitlab.String(message),
+	message := releaseDescription(stat, triggers, outputs)
+	if t.plan != nil {
+		t.plan.Add(&PlanAction{
+			Type:        CreateReleasePlanAction,
+			Rule:        planRuleName(rule),
+			Tag:         tag.Name,
+			Description: message,
+		})
+		return nil
 	}
-	_, _, err = t.gitLab.CreateRelease(t.proj, opts)
+	err = t.forge.CreateRelease(tag.Name, message)
 	if err != nil {
 		logrus.Warningf("Failed to create release: %v", err)
 	}
@@ -324,86 +855,58 @@ func (t *Tracker) UpdateTag(tag *gitlab.Tag, force bool, changes []string) error
 }
 
 func (t *Tracker) LoadEnvironment() error {
-	token := os.Getenv("GITLAB_TOKEN")
-	if len(token) == 0 {
-		return errors.New("GITLAB_TOKEN must be specified")
-	}
-	t.gitLabToken = token
-	baseURL := os.Getenv("CI_API_V4_URL")
-	if len(baseURL) == 0 {
-		return errors.New("CI_API_V4_URL must be specified")
-	}
-	t.gitLabURL = baseURL
-	t.beforeRef = os.Getenv("CI_COMMIT_BEFORE_SHA")
-	ref := os.Getenv("CI_COMMIT_SHA")
-	if len(ref) == 0 {
-		return errors.New("CI_COMMIT_SHA must be specified")
-	}
-	t.ref = ref
-	proj := os.Getenv("CI_PROJECT_PATH")
-	if len(proj) == 0 {
-		return errors.New("CI_PROJECT_PATH must be specified")
-	}
-	t.proj = proj
-	return nil
-}
-
-func (t *Tracker) templateRulesWithMatrixFromDir(rule *Rule) error {
-	fi, err := ioutil.ReadDir(t.config.MatrixFromDir)
+	provider := t.config.provider()
+	forgeEnv := forgeEnvironments[provider]
+	if len(forgeEnv.TokenVar) > 0 {
+		token := os.Getenv(forgeEnv.TokenVar)
+		if len(token) == 0 {
+			return fmt.Errorf("%s must be specified", forgeEnv.TokenVar)
+		}
+		t.apiToken = token
+	}
+	adapter := detectCIAdapter()
+	logrus.Debugf("Using %s environment.", adapter.Name)
+	env, err := adapter.Load()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to load %s environment: %v", adapter.Name, err)
 	}
-	parsedRules := map[string]*Rule{}
-	var i int
-	for _, item := range fi {
-		if !item.IsDir() {
-			continue
+	env.merge(t.overrides)
+	if len(forgeEnv.APIURLVar) > 0 {
+		baseURL := GetStringEnv(forgeEnv.APIURLVar, forgeEnv.APIURLDefault)
+		if len(env.APIURL) > 0 {
+			baseURL = env.APIURL
 		}
-		ref := rule.Clone()
-		err := ref.ParseAsTemplate(map[string]string{
-			"Item": path.Base(item.Name()),
-		})
-		if err != nil {
-			return err
+		if len(baseURL) == 0 {
+			return fmt.Errorf("%s must be specified", forgeEnv.APIURLVar)
 		}
-		parsedRules[fmt.Sprintf("matrix-%d", i)] = ref
-		i++
+		t.apiURL = baseURL
 	}
-	t.config.Rules = parsedRules
-	return nil
-}
-
-func (t *Tracker) templateRulesWithMatrixRaw(rule *Rule) error {
-	parsedRules := map[string]*Rule{}
-	for _, item := range t.config.Matrix {
-		ref := rule.Clone()
-		err := ref.ParseAsTemplate(map[string]string{
-			"Item": item,
-		})
+	if len(env.Ref) == 0 && len(adapter.RefVar) == 0 {
+		env.Ref, err = t.headCommit()
 		if err != nil {
 			return err
 		}
-		parsedRules[item] = ref
 	}
-	t.config.Rules = parsedRules
+	if len(env.Ref) == 0 {
+		return fmt.Errorf("%s must be specified", adapter.RefVar)
+	}
+	// Remote of the plain git provider doesn't need a project
+	if len(env.Project) == 0 && provider != GitForge {
+		return fmt.Errorf("%s must be specified", adapter.ProjectVar)
+	}
+	t.ref = env.Ref
+	t.beforeRef = env.BeforeRef
+	t.proj = env.Project
 	return nil
 }
 
-func (t *Tracker) TemplateRulesWithMatrix() error {
-	if len(t.config.Matrix) == 0 && len(t.config.MatrixFromDir) == 0 {
-		return nil
-	}
-	if len(t.config.Rules) > 1 || len(t.config.Rules) == 0 {
-		return errors.New("matrix can be used only with single rule")
-	}
-	matrixRule, ok := t.config.Rules["matrix"]
-	if !ok {
-		return errors.New("matrix can be used only with rule that named as `matrix`")
-	}
-	if len(t.config.Matrix) > 0 {
-		return t.templateRulesWithMatrixRaw(matrixRule)
+// headCommit returns commit of HEAD in working directory
+func (t *Tracker) headCommit() (string, error) {
+	output, err := t.gitCommand("rev-parse", "HEAD").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD commit: %v: %s", err, strings.TrimSpace(string(output)))
 	}
-	return t.templateRulesWithMatrixFromDir(matrixRule)
+	return strings.TrimSpace(string(output)), nil
 }
 
 func (t *Tracker) LoadRules(filename string) error {
@@ -430,9 +933,15 @@ func (t *Tracker) LoadRules(filename string) error {
 		}
 	}
 
+	if err := t.config.Validate(); err != nil {
+		return err
+	}
 	if err := t.TemplateRulesWithMatrix(); err != nil {
 		return err
 	}
+	if err := t.ValidateDependencies(); err != nil {
+		return err
+	}
 	for _, rule := range t.config.Rules {
 		if rule.TagSuffixFileRef == nil {
 			continue
@@ -452,8 +961,41 @@ func (t *Tracker) gitCommand(arg ...string) *exec.Cmd {
 	return cmd
 }
 
+// IsAncestor reports whether commit is an ancestor of ref or the same commit
+func (t *Tracker) IsAncestor(commit, ref string) (bool, error) {
+	if t.config.diffSource() == DiffSourceAPI {
+		base, err := t.mergeBase(commit, ref)
+		if err != nil {
+			return false, err
+		}
+		return base == commit, nil
+	}
+	output, err := t.gitCommand("merge-base", "--is-ancestor", commit, ref).CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("%v: %s", err, string(output))
+}
+
 func (t *Tracker) Diff(head, sha string) (changes []string, err error) {
 	logrus.Debugf("Diff head with %s.", sha)
+	if t.config.diffSource() == DiffSourceAPI {
+		fileChanges, err := t.compare(head, sha)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range fileChanges {
+			changes = append(changes, change.Path)
+			// Rules of renamed or deleted file are matched by its old path
+			if len(change.OldPath) > 0 {
+				changes = append(changes, change.OldPath)
+			}
+		}
+		return changes, nil
+	}
 	output, err := t.gitCommand("diff", head, sha, "--name-only").CombinedOutput()
 	if err != nil {
 		return nil, err
@@ -466,8 +1008,49 @@ func (t *Tracker) Diff(head, sha string) (changes []string, err error) {
 	return
 }
 
+// mergeBase returns common ancestor of commits
+func (t *Tracker) mergeBase(a, b string) (string, error) {
+	if t.config.diffSource() == DiffSourceAPI {
+		comparer, ok := t.forge.(Comparer)
+		if !ok {
+			return "", fmt.Errorf("provider %s doesn't support comparing commits with API", t.config.provider())
+		}
+		return comparer.MergeBase(a, b)
+	}
+	output, err := t.gitCommand("merge-base", a, b).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// compare returns changes between commits with compare API of the forge
+func (t *Tracker) compare(from, to string) ([]*FileChange, error) {
+	comparer, ok := t.forge.(Comparer)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support comparing commits with API", t.config.provider())
+	}
+	return comparer.Compare(from, to)
+}
+
 func (t *Tracker) DiffStat(head, sha string, files []string) (string, error) {
 	logrus.Debugf("Diff stat head with %s for %s.", sha, strings.Join(files, ", "))
+	if t.config.diffSource() == DiffSourceAPI {
+		fileChanges, err := t.compare(head, sha)
+		if err != nil {
+			return "", err
+		}
+		filtered := make([]*FileChange, 0, len(files))
+		for _, change := range fileChanges {
+			for _, file := range files {
+				if change.Path == file || change.OldPath == file {
+					filtered = append(filtered, change)
+					break
+				}
+			}
+		}
+		return formatDiffStat(filtered), nil
+	}
 	// fatal: ambiguous argument 'README.md2': unknown revision or path not in the working tree.
 	// Use '--' to separate paths from revisions, like this:
 	// 'git <command> [<revision>...] -- [<file>...]'
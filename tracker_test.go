@@ -6,11 +6,11 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
-
-	"github.com/xanzy/go-gitlab"
 )
 
 func TestDiff(t *testing.T) {
@@ -93,6 +93,21 @@ func TestLoadRules_Basic(t *testing.T) {
 	}
 }
 
+func TestLoadRules_Paths(t *testing.T) {
+	paths := []string{"services/foo/**", "libs/common/**"}
+	exclude := []string{"services/foo/docs/**", "*.md"}
+	for _, filename := range []string{"valid_paths.yaml", "valid_paths.hcl", "valid_paths.json"} {
+		tracker := &Tracker{}
+		if err := tracker.LoadRules(path.Join("test_data", filename)); err != nil {
+			t.Fatal(err)
+		}
+		rule := tracker.config.Rules["foo"]
+		if !reflect.DeepEqual(rule.Paths, paths) || !reflect.DeepEqual(rule.Exclude, exclude) {
+			t.Errorf("%s. Must be %v excluding %v, but got %v excluding %v", filename, paths, exclude, rule.Paths, rule.Exclude)
+		}
+	}
+}
+
 func TestLoadRules_Matrix(t *testing.T) {
 	tracker := &Tracker{}
 	err := tracker.LoadRules("test_data/invalid_matrix_1.yaml")
@@ -143,9 +158,9 @@ func TestLoadRules_MatrixFromDir(t *testing.T) {
 		t.Errorf("Must be %d, but got %d", 3, len(tracker.config.Rules))
 	}
 	tests := map[string]string{
-		"matrix-0": "prepare-itemA.sh",
-		"matrix-1": "prepare-itemB.sh",
-		"matrix-2": "prepare-itemC.sh",
+		"itemA": "prepare-itemA.sh",
+		"itemB": "prepare-itemB.sh",
+		"itemC": "prepare-itemC.sh",
 	}
 	for name, path := range tests {
 		r, ok := tracker.config.Rules[name]
@@ -159,6 +174,32 @@ func TestLoadRules_MatrixFromDir(t *testing.T) {
 	}
 }
 
+func TestLoadRules_RuleMatrix(t *testing.T) {
+	expected := map[string]string{
+		"app-foo-production": "foo-production",
+		"app-foo-staging":    "foo-staging",
+		"app-bar-production": "bar-production",
+		"app-baz-production": "baz-production",
+		"lib":                "lib",
+	}
+	for _, filename := range []string{"valid_rule_matrix.yaml", "valid_rule_matrix.hcl", "valid_rule_matrix.json"} {
+		tracker := &Tracker{}
+		if err := tracker.LoadRules(path.Join("test_data", filename)); err != nil {
+			t.Fatalf("%s. %v", filename, err)
+		}
+		tags := make(map[string]string)
+		for name, rule := range tracker.config.Rules {
+			tags[name] = rule.Tag
+			if rule.Matrix != nil {
+				t.Errorf("%s. Rule %s must be expanded", filename, name)
+			}
+		}
+		if !reflect.DeepEqual(tags, expected) {
+			t.Errorf("%s. Must be %v, but got %v", filename, expected, tags)
+		}
+	}
+}
+
 func TestGetTagSuffixForRule(t *testing.T) {
 	tracker := &Tracker{
 		dir: "./",
@@ -314,11 +355,27 @@ func TestNewTracker(t *testing.T) {
 		t.Fatal(err)
 	}
 	fillEnvVars()
-	_, err = NewTracker(dir)
+	_, err = NewTracker(dir, "", Environment{})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = NewTracker(dir, "test_data/valid.yaml", Environment{})
 	if err != nil {
 		t.Error(err)
 	}
+	_, err = NewTracker(dir, "test_data/not-found.yaml", Environment{})
+	if err == nil {
+		t.Error("Must be an error, but got nil")
+	}
 	cleanupEnvVars()
+	_, err = NewTracker(dir, "", Environment{})
+	if err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	_, err = LoadTracker(dir, "test_data/valid.yaml")
+	if err != nil {
+		t.Error(err)
+	}
 }
 
 func TestPostTagHooks(t *testing.T) {
@@ -527,9 +584,8 @@ func TestCreateTagIfNotExists(t *testing.T) {
 	refAtStart := "000"
 	refAtChange := "111"
 	tracker := &Tracker{
-		gitLab: NewFakeClient(),
-		proj:   "ABCD",
-		ref:    refAtStart,
+		forge: NewFakeForge(),
+		ref:   refAtStart,
 	}
 	_, _, err := tracker.CreateTagIfNotExists("foobar")
 	if err != nil {
@@ -540,43 +596,67 @@ func TestCreateTagIfNotExists(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	tag, _, err := tracker.gitLab.GetTag(tracker.proj, "foobar")
+	tag, err := tracker.forge.GetTag("foobar")
 	if err != nil {
 		t.Error(err)
 	}
-	if tag.Commit.ID != refAtStart {
-		t.Errorf("Must be %q, but got %q", refAtStart, tag.Commit.ID)
+	if tag.Commit != refAtStart {
+		t.Errorf("Must be %q, but got %q", refAtStart, tag.Commit)
+	}
+}
+
+func TestCreateTagIfNotExists_Conflict(t *testing.T) {
+	client := NewFakeClient()
+	forge := &gitlabForge{
+		client:  client,
+		project: "ABCD",
+	}
+	if _, err := forge.CreateTag("foobar", "000", tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	forge.client = &gitlabRacingCreate{
+		gitlabClient: client,
+		hidden:       make(map[string]bool),
+	}
+	tracker := &Tracker{
+		forge: forge,
+		ref:   "111",
+	}
+	exists, tag, err := tracker.CreateTagIfNotExists("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("Must be existing tag")
+	}
+	if tag.Commit != "000" {
+		t.Errorf("Must be 000, but got %s", tag.Commit)
 	}
 }
 
 func TestUpdateTag(t *testing.T) {
 	tracker := &Tracker{
-		gitLab: NewFakeClient(),
-		git:    "git",
-		proj:   "ABCD",
-		ref:    "a7c947751dba7fc8ec1877baa33834c09d2a5df3",
-	}
-	err := tracker.UpdateTag(&gitlab.Tag{
-		Commit: &gitlab.Commit{
-			ID: "4599ce4d09ef53a832d673fa471ecea52b69501d",
-		},
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   "a7c947751dba7fc8ec1877baa33834c09d2a5df3",
+	}
+	err := tracker.UpdateTag(&Tag{
+		Commit:  "4599ce4d09ef53a832d673fa471ecea52b69501d",
 		Name:    "foobar",
 		Message: "ABC",
 	}, false, []string{"main.go"})
 	if err != nil {
 		t.Error(err)
 	}
-	err = tracker.UpdateTag(&gitlab.Tag{
-		Commit: &gitlab.Commit{
-			ID: "000",
-		},
+	err = tracker.UpdateTag(&Tag{
+		Commit:  "000",
 		Name:    "foobar",
 		Message: "DFG",
 	}, true, nil)
 	if err != nil {
 		t.Error(err)
 	}
-	_, _, err = tracker.gitLab.GetTag("ABCD", "foobar")
+	_, err = tracker.forge.GetTag("foobar")
 	if err != nil {
 		t.Error(err)
 	}
@@ -597,10 +677,9 @@ func TestTrackerPipeline1(t *testing.T) {
 		t.Fatal(err)
 	}
 	tracker := &Tracker{
-		gitLab: NewFakeClient(),
-		git:    "git",
-		proj:   "ABCD",
-		ref:    commit,
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
 		config: Config{
 			Rules: map[string]*Rule{
 				"foobar": {
@@ -613,11 +692,11 @@ func TestTrackerPipeline1(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatalf("tracker.Run error: %v", err)
 	}
-	tag, _, err := tracker.gitLab.GetTag("ABCD", "1.0.0", nil)
+	tag, err := tracker.forge.GetTag("1.0.0")
 	if err != nil {
 		t.Fatalf("GetTag error: %v", err)
 	}
-	if tag.Commit.ID != commit {
+	if tag.Commit != commit {
 		t.Errorf("Tag commit must be %s, but got %s", commit, tag.Commit)
 	}
 	// Diff returns an error
@@ -642,11 +721,10 @@ func TestTrackerPipeline2(t *testing.T) {
 	}
 	commitAtStart := commit
 	tracker := &Tracker{
-		gitLab: NewFakeClient(),
-		git:    "git",
-		proj:   "ABCD",
-		ref:    commit,
-		dir:    repoDir,
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
 		config: Config{
 			Checks: ChecksConfig{
 				PreFlight: map[string]*Command{
@@ -678,12 +756,12 @@ func TestTrackerPipeline2(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatalf("tracker.Run error: %v", err)
 	}
-	tag, _, err := tracker.gitLab.GetTag("ABCD", "foobar@1.0.0", nil)
+	tag, err := tracker.forge.GetTag("foobar@1.0.0")
 	if err != nil {
 		t.Fatalf("GetTag error: %v", err)
 	}
-	if tag.Commit.ID != commit {
-		t.Errorf("Tag commit must be %s, but got %s", commit, tag.Commit.ID)
+	if tag.Commit != commit {
+		t.Errorf("Tag commit must be %s, but got %s", commit, tag.Commit)
 	}
 	body := `image: foobar:2.0.0`
 	if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte(body), os.ModePerm); err != nil {
@@ -701,12 +779,12 @@ func TestTrackerPipeline2(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatalf("tracker.Run error: %v", err)
 	}
-	tag, _, err = tracker.gitLab.GetTag("ABCD", "foobar@2.0.0", nil)
+	tag, err = tracker.forge.GetTag("foobar@2.0.0")
 	if err != nil {
 		t.Fatalf("GetTag error: %v", err)
 	}
-	if tag.Commit.ID != commit {
-		t.Errorf("Tag commit must be %s, but got %s", commit, tag.Commit.ID)
+	if tag.Commit != commit {
+		t.Errorf("Tag commit must be %s, but got %s", commit, tag.Commit)
 	}
 	body = `image: foobar:1.0.0`
 	if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte(body), os.ModePerm); err != nil {
@@ -724,13 +802,13 @@ func TestTrackerPipeline2(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatalf("tracker.Run error: %v", err)
 	}
-	tag, _, err = tracker.gitLab.GetTag("ABCD", "foobar@1.0.0", nil)
+	tag, err = tracker.forge.GetTag("foobar@1.0.0")
 	if err != nil {
 		t.Fatalf("GetTag error: %v", err)
 	}
 	// After switching to existing tag we must check commit sha
-	if tag.Commit.ID != commitAtStart {
-		t.Errorf("Tag commit must be %s, but got %s", commitAtStart, tag.Commit.ID)
+	if tag.Commit != commitAtStart {
+		t.Errorf("Tag commit must be %s, but got %s", commitAtStart, tag.Commit)
 	}
 }
 
@@ -772,11 +850,10 @@ func TestTrackerPipeline3(t *testing.T) {
 		t.Fatal(err)
 	}
 	tracker := &Tracker{
-		gitLab: NewFakeClient(),
-		git:    "git",
-		proj:   "ABCD",
-		ref:    commit,
-		dir:    repoDir,
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
 		config: Config{
 			Rules: rules,
 		},
@@ -786,12 +863,12 @@ func TestTrackerPipeline3(t *testing.T) {
 	}
 	for _, app := range apps {
 		tagName := fmt.Sprintf("%s@1.0.0", app)
-		tag, _, err := tracker.gitLab.GetTag("ABCD", tagName, nil)
+		tag, err := tracker.forge.GetTag(tagName)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if tag.Commit.ID != tracker.ref {
-			t.Errorf("Tag %s commit must be %s, but got %s", tagName, tracker.ref, tag.Commit.ID)
+		if tag.Commit != tracker.ref {
+			t.Errorf("Tag %s commit must be %s, but got %s", tagName, tracker.ref, tag.Commit)
 		}
 	}
 	err = ioutil.WriteFile(path.Join(repoDir, "app1", "test_file"), []byte(`test_file`), os.ModePerm)
@@ -814,32 +891,32 @@ func TestTrackerPipeline3(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatal(err)
 	}
-	tag, _, err := tracker.gitLab.GetTag("ABCD", "app1@1.0.0", nil)
+	tag, err := tracker.forge.GetTag("app1@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if tag.Commit.ID != tracker.ref {
-		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit.ID)
+	if tag.Commit != tracker.ref {
+		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit)
 	}
-	tagApp2, _, err := tracker.gitLab.GetTag("ABCD", "app2@1.0.0", nil)
+	tagApp2, err := tracker.forge.GetTag("app2@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	tag, _, err = tracker.gitLab.GetTag("ABCD", "app2@2.0.0", nil)
+	tag, err = tracker.forge.GetTag("app2@2.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if tag.Commit.ID != tracker.ref {
-		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit.ID)
+	if tag.Commit != tracker.ref {
+		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit)
 	}
 	for _, app := range apps[1:] {
 		tagName := fmt.Sprintf("%s@1.0.0", app)
-		tag, _, err := tracker.gitLab.GetTag("ABCD", tagName, nil)
+		tag, err := tracker.forge.GetTag(tagName)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if tag.Commit.ID == tracker.ref {
-			t.Errorf("Tag %s commit must be %s, but got %s", tagName, tracker.ref, tag.Commit.ID)
+		if tag.Commit == tracker.ref {
+			t.Errorf("Tag %s commit must be %s, but got %s", tagName, tracker.ref, tag.Commit)
 		}
 	}
 	err = ioutil.WriteFile(path.Join(repoDir, "app2", "application"), []byte(`app2:1.0.0`), os.ModePerm)
@@ -858,14 +935,398 @@ func TestTrackerPipeline3(t *testing.T) {
 	if err := tracker.Run(false); err != nil {
 		t.Fatal(err)
 	}
-	tag, _, err = tracker.gitLab.GetTag("ABCD", "app2@1.0.0", nil)
+	tag, err = tracker.forge.GetTag("app2@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != tracker.ref {
+		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit)
+	}
+	if tagApp2.Commit == tag.Commit {
+		t.Errorf("Tag %s commit must be %s not the same as before update", tag.Name, tag.Commit)
+	}
+}
+
+func TestUpdateTags_Concurrency(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-concurrency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := make(map[string]*Rule)
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("app%d", i)
+		rules[name] = &Rule{
+			Path: "test_file",
+			Tag:  name,
+		}
+	}
+	rules["failed"] = &Rule{
+		Tag: "failed",
+		TagSuffixFileRef: &TagSuffixFileRef{
+			File: "not-found",
+		},
+	}
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commit,
+		dir:   repoDir,
+		config: Config{
+			Concurrency: 5,
+			Hooks: HooksConfig{
+				PreProcess: map[string]*Command{
+					"wait": {
+						Command: []string{"sleep", "1"},
+					},
+				},
+			},
+			Rules: rules,
+		},
+	}
+	st := time.Now()
+	if err := tracker.UpdateTags(false); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	if time.Since(st) > 3*time.Second {
+		t.Errorf("Rules must be processed concurrently, but took %s", time.Since(st))
+	}
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("app%d", i)
+		if _, err := tracker.forge.GetTag(name); err != nil {
+			t.Errorf("Tag %s: %v", name, err)
+		}
+		if rules[name].Name != name {
+			t.Errorf("Must be %s, but got %s", name, rules[name].Name)
+		}
+	}
+	os.Setenv("GT_CONCURRENCY", "2")
+	defer os.Unsetenv("GT_CONCURRENCY")
+	if c := tracker.concurrency(); c != 2 {
+		t.Errorf("Must be 2, but got %d", c)
+	}
+	tracker.config.Concurrency = 0
+	os.Unsetenv("GT_CONCURRENCY")
+	if c := tracker.concurrency(); c != 1 {
+		t.Errorf("Must be 1, but got %d", c)
+	}
+}
+
+func TestUpdateTag_RolledBack(t *testing.T) {
+	tagRetryConfig.Interval = time.Millisecond
+	defer func() {
+		tagRetryConfig.Interval = time.Second
+	}()
+	forge := &gitlabForge{
+		client: gitlabFailingCreate{
+			gitlabClient: NewFakeClient(),
+			failRef:      "111",
+		},
+		project: "ABCD",
+	}
+	tracker := &Tracker{
+		forge: forge,
+		ref:   "000",
+	}
+	_, _, err := tracker.CreateTagIfNotExists("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := tracker.forge.GetTag("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.Message = "Previous message"
+	tracker.ref = "111"
+	err = tracker.UpdateTag(tag, true, nil)
+	if !IsErrTagMoveRolledBack(err) {
+		t.Fatalf("Must be ErrTagMoveRolledBack, but got %v", err)
+	}
+	tag, err = tracker.forge.GetTag("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != "000" {
+		t.Errorf("Must be 000, but got %s", tag.Commit)
+	}
+	if tag.Message != "Previous message" {
+		t.Errorf("Must be previous message, but got %q", tag.Message)
+	}
+	forge.client = gitlabFailingCreate{
+		gitlabClient: forge.client,
+		failRef:      "000",
+	}
+	err = tracker.UpdateTag(tag, true, nil)
+	if err == nil || IsErrTagMoveRolledBack(err) {
+		t.Errorf("Must be an error about failed restore, but got %v", err)
+	}
+}
+
+func TestTrackerPipeline_StaleRef(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "tracker-stale-ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	le := &localExecutor{repoDir}
+	if err := le.initWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	commitOld, err := le.commit()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if tag.Commit.ID != tracker.ref {
-		t.Errorf("Tag %s commit must be %s, but got %s", tag.Name, tracker.ref, tag.Commit.ID)
+	if err := ioutil.WriteFile(path.Join(repoDir, "test_file"), []byte(`image: foobar:2.0.0`), os.ModePerm); err != nil {
+		t.Fatal(err)
 	}
-	if tagApp2.Commit.ID == tag.Commit.ID {
-		t.Errorf("Tag %s commit must be %s not the same as before update", tag.Name, tag.Commit.ID)
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	commitNew, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &Tracker{
+		forge: NewFakeForge(),
+		git:   "git",
+		ref:   commitNew,
+		dir:   repoDir,
+		config: Config{
+			Rules: map[string]*Rule{
+				"foobar": {
+					Path: "test_file",
+					Tag:  "foobar",
+				},
+			},
+		},
+	}
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	// Pipeline for the older commit finished after the newer one
+	tracker.ref = commitOld
+	tracker.beforeRef = commitNew
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := tracker.forge.GetTag("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != commitNew {
+		t.Errorf("Tag commit must be %s, but got %s", commitNew, tag.Commit)
+	}
+	tracker.config.OnStaleRef = StaleRefFail
+	if err := tracker.Run(false); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	isAncestor, err := tracker.IsAncestor(commitOld, commitNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isAncestor {
+		t.Errorf("%s must be an ancestor of %s", commitOld, commitNew)
+	}
+	_, err = tracker.IsAncestor("foobar", commitNew)
+	if err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestLoadEnvironment_Provider(t *testing.T) {
+	fillEnvVars()
+	defer cleanupEnvVars()
+	tracker := &Tracker{
+		config: Config{
+			Provider: GitHubForge,
+		},
+	}
+	if err := tracker.LoadEnvironment(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	os.Setenv("GITHUB_TOKEN", "token")
+	defer os.Unsetenv("GITHUB_TOKEN")
+	if err := tracker.LoadEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if tracker.apiURL != defaultGitHubAPIURL {
+		t.Errorf("Must be %s, but got %s", defaultGitHubAPIURL, tracker.apiURL)
+	}
+	tracker.config.Provider = GiteaForge
+	if err := tracker.LoadEnvironment(); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestDiffBase(t *testing.T) {
+	tracker, le, cleanup := newGitForgeWorkspace(t)
+	defer cleanup()
+	base := tracker.ref
+	if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte("image: foobar:2.0.0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := le.addAndCommit(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := le.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := le.exec([]string{"git", "fetch", "origin"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CI_DEFAULT_BRANCH", "master")
+	defer os.Unsetenv("CI_DEFAULT_BRANCH")
+	tracker.ref = ref
+	rule := &Rule{Name: "foobar"}
+	tag := &Tag{Name: "foobar", Commit: base}
+	missing := strings.Repeat("1", 40)
+	tests := []struct {
+		beforeRef string
+		tag       string
+		base      string
+	}{
+		{beforeRef: base, tag: missing, base: base},
+		{beforeRef: "", tag: base, base: base},
+		{beforeRef: strings.Repeat("0", 40), tag: base, base: base},
+		{beforeRef: missing, tag: base, base: base},
+		// merge-base of the ref with origin/master
+		{beforeRef: missing, tag: missing, base: base},
+	}
+	for i, test := range tests {
+		tracker.beforeRef = test.beforeRef
+		tag.Commit = test.tag
+		b, err := tracker.diffBase(rule, tag)
+		if err != nil {
+			t.Errorf("%d. %v", i, err)
+			continue
+		}
+		if b != test.base {
+			t.Errorf("%d. Must be %s, but got %s", i, test.base, b)
+		}
+	}
+	os.Setenv("CI_DEFAULT_BRANCH", "not-found")
+	if _, err := tracker.diffBase(rule, tag); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+}
+
+func TestEnsureCommit(t *testing.T) {
+	tracker, le, cleanup := newGitForgeWorkspace(t)
+	defer cleanup()
+	first := tracker.ref
+	for i := 0; i < 3; i++ {
+		body := fmt.Sprintf("image: foobar:%d.0.0", i+2)
+		if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte(body), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := le.addAndCommit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := le.exec([]string{"git", "push", "origin", "HEAD:refs/heads/master"}); err != nil {
+		t.Fatal(err)
+	}
+	cloneDir := path.Join(path.Dir(le.wd), "clone")
+	remoteURL := "file://" + path.Join(path.Dir(le.wd), "remote.git")
+	if out, err := le.exec([]string{"git", "clone", "--depth", "1", remoteURL, cloneDir}); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	tracker.dir = cloneDir
+	if !tracker.isShallow() {
+		t.Fatal("Clone must be shallow")
+	}
+	tracker.config.FetchDepthLimit = -1
+	if err := tracker.ensureCommit(first); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	tracker.config.FetchDepthLimit = 0
+	if err := tracker.ensureCommit(first); err != nil {
+		t.Fatal(err)
+	}
+	if !tracker.commitExists(first) {
+		t.Errorf("Commit %s must be fetched", first)
+	}
+	missing := strings.Repeat("1", 40)
+	if err := tracker.ensureCommit(missing); err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	// Missing commit isn't fetched again, even from unavailable remote
+	tracker.config.GitRemote = "not-found"
+	if err := tracker.ensureCommit(missing); err == nil || strings.Contains(err.Error(), "not-found") {
+		t.Errorf("Must be cached error, but got %v", err)
+	}
+}
+
+func TestTrackerPipeline_ShallowFetchFailed(t *testing.T) {
+	tracker, le, cleanup := newGitForgeWorkspace(t)
+	defer cleanup()
+	first := tracker.ref
+	for i := 0; i < 3; i++ {
+		body := fmt.Sprintf("image: foobar:%d.0.0", i+2)
+		if err := ioutil.WriteFile(path.Join(le.wd, "test_file"), []byte(body), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := le.addAndCommit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := le.exec([]string{"git", "push", "origin", "HEAD:refs/heads/master"}); err != nil {
+		t.Fatal(err)
+	}
+	cloneDir := path.Join(path.Dir(le.wd), "clone")
+	remoteURL := "file://" + path.Join(path.Dir(le.wd), "remote.git")
+	if out, err := le.exec([]string{"git", "clone", "--depth", "2", remoteURL, cloneDir}); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	clone := &localExecutor{cloneDir}
+	head, err := clone.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := clone.exec([]string{"git", "rev-parse", "HEAD^"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forge := NewFakeForge()
+	if _, err := forge.CreateTag("foobar", first, tagMessage); err != nil {
+		t.Fatal(err)
+	}
+	tracker.forge = forge
+	tracker.dir = cloneDir
+	tracker.ref = head
+	tracker.beforeRef = strings.TrimSpace(string(before))
+	tracker.config = Config{
+		GitRemote: "not-found",
+		Rules: map[string]*Rule{
+			"foobar": {
+				Path: "test_file",
+				Tag:  "foobar",
+			},
+		},
+	}
+	// Tag commit can't be fetched, so it's unknown whether tag is moved
+	// backwards
+	if err := tracker.Run(false); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := forge.GetTag("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Commit != first {
+		t.Errorf("Tag commit must be %s, but got %s", first, tag.Commit)
+	}
+	tracker.config.OnStaleRef = StaleRefFail
+	if err := tracker.Run(false); err == nil {
+		t.Error("Must be an error, but got nil")
 	}
 }
@@ -18,6 +18,9 @@ func RetryTransport() http.RoundTripper {
 		}
 		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
 	}
+	// Last response is returned as is when retries are exhausted, so
+	// status code (e.g. 429) can be handled by API client
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
 	return &retryableTransport{client}
 }
 
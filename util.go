@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -27,7 +32,13 @@ func ConfigureLogging(logLevel string) error {
 func ProcessCommand(rule *Rule, args []string) (*exec.Cmd, error) {
 	var argsExec []string
 	for _, templ := range args {
-		arg, err := gotmpl(templ, rule)
+		render := gotmpl
+		// Output of the hook which wasn't run or failed to be captured must
+		// not be passed as <no value>
+		if strings.Contains(templ, ".Outputs") {
+			render = matrixTmpl
+		}
+		arg, err := render(templ, rule)
 		if err != nil {
 			return nil, err
 		}
@@ -46,6 +57,82 @@ func ProcessCommand(rule *Rule, args []string) (*exec.Cmd, error) {
 	return c, nil
 }
 
+// commandTerminationTimeout is a time command is given to exit after
+// termination signal before it's killed
+var commandTerminationTimeout = 10 * time.Second
+
+// runningCommands are commands started by RunCommand, they are in their own
+// process groups and don't receive signals sent to the tracker
+var runningCommands = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]struct{}
+}{cmds: make(map[*exec.Cmd]struct{})}
+
+// killRunningCommands kills process groups of all running commands
+func killRunningCommands() {
+	runningCommands.Lock()
+	defer runningCommands.Unlock()
+	for cmd := range runningCommands.cmds {
+		if err := killProcessGroup(cmd); err != nil {
+			logrus.Debugf("Failed to kill %v: %v", cmd.Args, err)
+		}
+	}
+}
+
+// RunCommand runs command in its own process group and writes its stdout
+// and stderr while it's running. The group is killed on timeout,
+// zero timeout means no timeout. If context is canceled, the group is
+// terminated and killed if it doesn't exit in commandTerminationTimeout.
+func RunCommand(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, stdout, stderr io.Writer) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	runningCommands.Lock()
+	if err := cmd.Start(); err != nil {
+		runningCommands.Unlock()
+		return err
+	}
+	runningCommands.cmds[cmd] = struct{}{}
+	runningCommands.Unlock()
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		runningCommands.Lock()
+		delete(runningCommands.cmds, cmd)
+		runningCommands.Unlock()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			// Termination is forwarded to let command clean up
+			if err := terminateProcessGroup(cmd); err != nil {
+				logrus.Debugf("Failed to terminate %v: %v", cmd.Args, err)
+			}
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(commandTerminationTimeout):
+			}
+		}
+		if err := killProcessGroup(cmd); err != nil {
+			logrus.Debugf("Failed to kill %v: %v", cmd.Args, err)
+		}
+		<-done
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrCommandTimeout{Timeout: timeout}
+		}
+		return ctx.Err()
+	}
+}
+
 func GetStringEnv(name string, def string) string {
 	if val, ok := os.LookupEnv(name); ok {
 		return val
@@ -62,10 +149,28 @@ func GetBoolEnv(name string, def bool) bool {
 	return def
 }
 
+func GetIntEnv(name string, def int) int {
+	if val, ok := os.LookupEnv(name); ok {
+		if i, err := strconv.Atoi(val); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
 func gotmpl(templ string, data interface{}) (string, error) {
-	var templateEng *template.Template
+	return executeTemplate(template.New("hook"), templ, data)
+}
+
+// matrixTmpl renders option of the rule with values of matrix combination,
+// missing fields of matrix items must not be rendered as <no value>, it's
+// used for commands with outputs of hooks too
+func matrixTmpl(templ string, data interface{}) (string, error) {
+	return executeTemplate(template.New("matrix").Option("missingkey=error"), templ, data)
+}
+
+func executeTemplate(templateEng *template.Template, templ string, data interface{}) (string, error) {
 	buf := bytes.NewBufferString("")
-	templateEng = template.New("hook")
 	if messageTempl, err := templateEng.Parse(templ); err != nil {
 		return "", fmt.Errorf("failed to parse template: %v", err)
 	} else if err := messageTempl.Execute(buf, data); err != nil {
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -72,6 +76,27 @@ func TestProcessCommand(t *testing.T) {
 	if err == nil {
 		t.Error("Must be an error, but got nil")
 	}
+	// Missing keys of maps are rendered as before matrix items were added
+	cmd, err := ProcessCommand(rule, []string{"echo", "{{.Values.foobar}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Args[1] != "<no value>" {
+		t.Errorf("Must be <no value>, but got %s", cmd.Args[1])
+	}
+	// but missing outputs are errors as the hook wasn't run or failed
+	_, err = ProcessCommand(rule, []string{"echo", "{{.Outputs.foobar}}"})
+	if err == nil {
+		t.Error("Must be an error, but got nil")
+	}
+	rule.Outputs = map[string]string{"foobar": "value"}
+	cmd, err = ProcessCommand(rule, []string{"echo", "{{.Outputs.foobar}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Args[1] != "value" {
+		t.Errorf("Must be value, but got %s", cmd.Args[1])
+	}
 }
 
 func TestGetBoolEnv(t *testing.T) {
@@ -85,9 +110,69 @@ func TestGetBoolEnv(t *testing.T) {
 	assert.Equal(t, false, GetBoolEnv("FOOBAR", false))
 }
 
+func TestGetIntEnv(t *testing.T) {
+	os.Unsetenv("FOOBAR")
+	assert.Equal(t, 1, GetIntEnv("FOOBAR", 1))
+	os.Setenv("FOOBAR", "10")
+	assert.Equal(t, 10, GetIntEnv("FOOBAR", 1))
+	os.Setenv("FOOBAR", "ABCD")
+	assert.Equal(t, 1, GetIntEnv("FOOBAR", 1))
+}
+
 func TestGetStringEnv(t *testing.T) {
 	os.Unsetenv("FOOBAR")
 	assert.Equal(t, "default", GetStringEnv("FOOBAR", "default"))
 	os.Setenv("FOOBAR", "specified")
 	assert.Equal(t, "specified", GetStringEnv("FOOBAR", "default"))
 }
+
+func TestRunCommand(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	err := RunCommand(context.Background(), exec.Command("echo", "foobar"), time.Second, buf, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "foobar\n" {
+		t.Errorf("Must be foobar, but got %q", buf.String())
+	}
+	if err := RunCommand(context.Background(), exec.Command("false"), 0, buf, buf); err == nil || IsErrCommandTimeout(err) {
+		t.Errorf("Must be an exit error, but got %v", err)
+	}
+	// Child holds output open, so command returns only if the whole group
+	// was killed
+	buf.Reset()
+	start := time.Now()
+	err = RunCommand(context.Background(), exec.Command("sh", "-c", "echo started; sleep 30 & sleep 30"), 200*time.Millisecond, buf, buf)
+	if !IsErrCommandTimeout(err) {
+		t.Fatalf("Must be timeout error, but got %v", err)
+	}
+	if buf.String() != "started\n" {
+		t.Errorf("Must be started, but got %q", buf.String())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Must be killed on timeout, but took %s", elapsed)
+	}
+}
+
+func TestExecCommandMap_Timeout(t *testing.T) {
+	tracker := &Tracker{
+		config: Config{
+			CommandTimeoutSeconds: 1,
+		},
+	}
+	commands := map[string]*Command{
+		"wait": {
+			Command:     []string{"sleep", "30"},
+			RetryConfig: &RetryConfig{Maximum: 1},
+		},
+	}
+	err := tracker.ExecCommandMap(PostUpdateTagCommandType, commands, nil)
+	if e, ok := err.(ErrFailedCommandExecution); !ok || !e.Timeout {
+		t.Errorf("Must be timeout error, but got %v", err)
+	}
+	commands["wait"].Command = []string{"false"}
+	err = tracker.ExecCommandMap(PostUpdateTagCommandType, commands, nil)
+	if e, ok := err.(ErrFailedCommandExecution); !ok || e.Timeout {
+		t.Errorf("Must be failed command error, but got %v", err)
+	}
+}